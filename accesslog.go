@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// clfTimeFormat is the timestamp layout used by NCSA/Apache logs.
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessLogMiddleware emits one NCSA log line per request to w. format is
+// "common" or "combined"; combined adds the referer and user-agent. Both
+// variants end with the handling time in microseconds, like Apache's %D.
+func accessLogMiddleware(format string, w io.Writer) fiber.Handler {
+	var mu sync.Mutex
+
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+		elapsed := time.Since(start)
+
+		// Errors are turned into responses by fiber's error handler only
+		// after the middleware chain unwinds, so take the code from the error.
+		status := c.Response().StatusCode()
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			status = fe.Code
+		}
+
+		size := "-"
+		if n := responseSize(c.Response()); n > 0 {
+			size = strconv.Itoa(n)
+		}
+
+		line := fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s",
+			c.IP(),
+			start.Format(clfTimeFormat),
+			c.Method(),
+			c.OriginalURL(),
+			c.Request().Header.Protocol(),
+			status,
+			size,
+		)
+		if format == "combined" {
+			line += fmt.Sprintf(" %q %q", orDash(c.Get(fiber.HeaderReferer)), orDash(c.Get(fiber.HeaderUserAgent)))
+		}
+		line += fmt.Sprintf(" %d\n", elapsed.Microseconds())
+
+		mu.Lock()
+		_, _ = io.WriteString(w, line)
+		mu.Unlock()
+
+		return err
+	}
+}
+
+// responseSize returns the body length to log. A streamed body (--throttle,
+// NDJSON) is only written once the middleware has returned, and reading it
+// here would drain it before the client saw a byte, so its Content-Length is
+// used instead: -1 when the length isn't known up front.
+func responseSize(resp *fasthttp.Response) int {
+	if resp.IsBodyStream() {
+		return resp.Header.ContentLength()
+	}
+	return len(resp.Body())
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// adminPrefix is where the control endpoints live. Nothing under it goes
+// through spec validation.
+const adminPrefix = "/__admin"
+
+// Maintenance state toggled through POST /__admin/maintenance.
+var (
+	maintenanceMode       atomic.Bool
+	maintenanceRetryAfter atomic.Int64
+)
+
+func init() {
+	maintenanceRetryAfter.Store(60)
+}
+
+// routeTable describes every route RegisterRoutes mounted, for
+// GET /__admin/routes, canned --routes included, sorted by path.
+var routeTable []routeInfo
+
+// routeInfo is one entry of GET /__admin/routes.
+type routeInfo struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Resource    string   `json:"resource,omitempty"`
+	OperationID string   `json:"operationId,omitempty"`
+	Responses   []string `json:"responses"` // declared status codes, e.g. "200", "4XX", "default"
+	Examples    bool     `json:"examples"`  // the success response has an example
+	Source      string   `json:"source"`    // "examples", "store" or "routes"
+}
+
+// describeRoute summarises a spec route. Reads with an example are answered
+// from it until the store holds records for the resource; everything else
+// goes to the store.
+func describeRoute(method, path string, route routeResource, op *openapi3.Operation, opts *Options) routeInfo {
+	info := routeInfo{Method: method, Path: path, Resource: route.Name, Responses: []string{}, Source: "store"}
+	if op == nil {
+		return info
+	}
+	info.OperationID = op.OperationID
+	for code := range op.Responses {
+		info.Responses = append(info.Responses, code)
+	}
+	sort.Strings(info.Responses)
+
+	_, resp := operationResponse(op, opts.successStatus(method, path, defaultStatus(method)))
+	if resp != nil {
+		for _, mt := range resp.Content {
+			if _, _, ok := mediaTypeExample(mt); ok {
+				info.Examples = true
+				break
+			}
+		}
+	}
+	if info.Examples && (method == fiber.MethodGet || method == fiber.MethodHead) {
+		info.Source = "examples"
+	}
+	return info
+}
+
+// registerAdminRoutes mounts the /__admin endpoints.
+func registerAdminRoutes(app *fiber.App, store *Store, opts *Options) {
+	admin := app.Group(adminPrefix)
+
+	// POST /__admin/maintenance?on=true&retryAfter=120
+	admin.Post("/maintenance", func(c *fiber.Ctx) error {
+		on, err := strconv.ParseBool(c.Query("on", "true"))
+		if err != nil {
+			return writeError(c, 400, "on must be true or false")
+		}
+		if ra := c.Query("retryAfter"); ra != "" {
+			secs, err := strconv.Atoi(ra)
+			if err != nil || secs < 0 {
+				return writeError(c, 400, "retryAfter must be a non-negative number of seconds")
+			}
+			maintenanceRetryAfter.Store(int64(secs))
+		}
+
+		maintenanceMode.Store(on)
+		if on {
+			log.Printf("🚧 Maintenance mode on (Retry-After: %ds)", maintenanceRetryAfter.Load())
+		} else {
+			log.Printf("🚧 Maintenance mode off")
+		}
+		return c.JSON(fiber.Map{
+			"maintenance": on,
+			"retryAfter":  maintenanceRetryAfter.Load(),
+		})
+	})
+
+	// POST /__admin/shutdown flushes the store, answers 202 with how the
+	// save went, then stops the server as Ctrl-C would.
+	admin.Post("/shutdown", func(c *fiber.Ctx) error {
+		saved := "saved"
+		if opts.NoPersist {
+			saved = "not persisted (--no-persist)"
+		}
+		if err := store.Flush(); err != nil {
+			saved = err.Error()
+		}
+		log.Printf("👋 Shutting down (requested through %s/shutdown)", adminPrefix)
+		go func() {
+			_ = app.Shutdown()
+		}()
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"shutdown": true, "store": saved})
+	})
+
+	// GET /__admin/routes
+	admin.Get("/routes", func(c *fiber.Ctx) error {
+		return c.JSON(routeTable)
+	})
+
+	// GET /__admin/store
+	admin.Get("/store", func(c *fiber.Ctx) error {
+		counts := fiber.Map{}
+		data := fiber.Map{}
+		for _, name := range store.Names() {
+			n, records, err := encodeCollection(store.Lookup(name))
+			if err != nil {
+				return err
+			}
+			counts[name], data[name] = n, records
+		}
+		return c.JSON(fiber.Map{"counts": counts, "data": data})
+	})
+
+	// GET /__admin/store/users
+	admin.Get("/store/:resource", func(c *fiber.Ctx) error {
+		col := store.Lookup(c.Params("resource"))
+		if col == nil {
+			return writeError(c, 404, "No resource named "+c.Params("resource"))
+		}
+		_, records, err := encodeCollection(col)
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(records)
+	})
+
+	// PUT /__admin/store/users/42 places a record at an exact id,
+	// replacing any record already there.
+	admin.Put("/store/:resource/:id", func(c *fiber.Ctx) error {
+		if opts.ReadOnly {
+			c.Set(fiber.HeaderAllow, "GET, HEAD, OPTIONS")
+			return writeError(c, fiber.StatusMethodNotAllowed, "Server is in read-only mode")
+		}
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil || id <= 0 {
+			return writeError(c, 400, "id must be a positive integer")
+		}
+		var record map[string]any
+		if err := json.Unmarshal(c.Body(), &record); err != nil || record == nil {
+			return writeError(c, 400, "Body must be a JSON object")
+		}
+		record["id"] = id
+
+		resource := c.Params("resource")
+		col := store.Collection(resource)
+		col.Lock()
+		defer col.Unlock()
+
+		status := 200
+		if i, existing := col.Find(id); existing != nil {
+			col.Records[i] = record
+		} else {
+			col.Append(record)
+			status = 201
+		}
+		saveStore(store, opts.DataFile, resource)
+		return c.Status(status).JSON(record)
+	})
+}
+
+// encodeCollection marshals a collection's records under its read lock, so
+// the result is a consistent snapshot even while requests write to it.
+func encodeCollection(col *Collection) (int, json.RawMessage, error) {
+	col.RLock()
+	defer col.RUnlock()
+	b, err := json.Marshal(col.Records)
+	return len(col.Records), b, err
+}
@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+func TestAdminStorePutReadOnly(t *testing.T) {
+	app := newTestApp(t, testSpec, `{"users": [{"id": 1, "name": "Ann"}]}`, &Options{Admin: true, ReadOnly: true})
+
+	resp, body := send(t, app, "PUT", "/__admin/store/users/1", `{"name":"Anne"}`)
+	if resp.StatusCode != 405 || resp.Header.Get("Allow") != "GET, HEAD, OPTIONS" {
+		t.Errorf("PUT under --readonly: got %d, Allow %q, %s", resp.StatusCode, resp.Header.Get("Allow"), body)
+	}
+	if _, body := send(t, app, "GET", "/users/1", ""); decode[map[string]any](t, body)["name"] != "Ann" {
+		t.Errorf("PUT under --readonly changed the store: %s", body)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// isBinaryMediaType reports whether a response of this media type carries
+// bytes rather than text, so its string examples hold base64.
+func isBinaryMediaType(s string) bool {
+	mt := parseMediaType(s)
+	switch mt.Type {
+	case "image":
+		return mt.Suffix != "xml" // image/svg+xml is text
+	case "audio", "video":
+		return true
+	case "application":
+		switch mt.Subtype {
+		case "octet-stream", "pdf", "zip", "gzip":
+			return true
+		}
+	}
+	return false
+}
+
+// decodeBinaryExample decodes a base64 example, with or without a
+// "data:image/png;base64," prefix. ok is false when s isn't base64, and the
+// example is then sent as it is.
+func decodeBinaryExample(s string) ([]byte, bool) {
+	if rest, found := strings.CutPrefix(s, "data:"); found {
+		if _, data, ok := strings.Cut(rest, ";base64,"); ok {
+			s = data
+		}
+	}
+	s = strings.Join(strings.Fields(s), "") // examples are often wrapped
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// setContentDisposition marks a binary response as a download named by
+// x-mock-filename on the response sent, or else on the operation. Without
+// one, the file is named after the operationId, or failing that the
+// resource, with an extension for its media type, e.g. exportReport.pdf.
+// A Content-Disposition already set, say by a scenario, is kept.
+func setContentDisposition(c *fiber.Ctx, op *openapi3.Operation, resource string) {
+	contentType := string(c.Response().Header.ContentType())
+	if !isBinaryMediaType(contentType) || len(c.Response().Header.Peek(fiber.HeaderContentDisposition)) > 0 {
+		return
+	}
+
+	var name string
+	if resp, ok := declaredResponse(op, c.Response().StatusCode()); ok {
+		name, _ = resp.Extensions[extFilename].(string)
+	}
+	if name == "" && op != nil {
+		name, _ = op.Extensions[extFilename].(string)
+	}
+	if name == "" {
+		name = resource
+		if op != nil && op.OperationID != "" {
+			name = op.OperationID
+		}
+		name += fileExtension(contentType)
+	}
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", name))
+}
+
+// fileExtension picks the usual extension for a binary media type.
+func fileExtension(contentType string) string {
+	switch sub := parseMediaType(contentType).Subtype; sub {
+	case "octet-stream":
+		return ".bin"
+	case "jpeg":
+		return ".jpg"
+	case "gzip":
+		return ".gz"
+	default:
+		return "." + sub
+	}
+}
+
+// placeholderImage draws a plain grey square in the given image format for
+// Prefer: dynamic=true responses that have no example. Only PNG, JPEG and
+// GIF can be drawn.
+func placeholderImage(contentType string) ([]byte, bool) {
+	const size = 64
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for i := range img.Pix {
+		img.Pix[i] = 0xcc
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch parseMediaType(contentType).Subtype {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg", "jpg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		pal := image.NewPaletted(img.Bounds(), []color.Color{color.Gray{Y: 0xcc}})
+		err = gif.Encode(&buf, pal, nil)
+	default:
+		return nil, false
+	}
+	if err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
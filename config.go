@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// envPrefix starts the environment variable read for each flag: --port is
+// MOCK_PORT and --log-level is MOCK_LOG_LEVEL.
+const envPrefix = "MOCK_"
+
+// envName returns the environment variable that sets a flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets every flag the command line left alone from its MOCK_*
+// environment variable, if set. Repeatable flags such as --data take a
+// comma-separated list.
+func applyEnv(fs *flag.FlagSet) error {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		v, ok := os.LookupEnv(envName(f.Name))
+		if !ok || explicit[f.Name] || err != nil {
+			return
+		}
+		values := []string{v}
+		switch f.Value.(type) {
+		case *stringList, *statusOverrides:
+			values = splitList(v)
+		}
+		for _, v := range values {
+			if setErr := fs.Set(f.Name, v); setErr != nil {
+				err = fmt.Errorf("%s: %v", envName(f.Name), setErr)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// applyConfig reads a --config file of flag values keyed by flag name, e.g.
+//
+//	port: 4000
+//	data: [data.json, fixtures.yaml]
+//	cors: true
+//	timing: timing.yaml
+//
+// and sets every flag the command line and environment left alone, so both
+// win over the file. Lists set a repeatable flag once per item. Keys that aren't
+// flags are an error.
+func applyConfig(fs *flag.FlagSet, file string) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var raw map[string]any
+	if err := codecFor(file).unmarshal(b, &raw); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == "config" || fs.Lookup(key) == nil {
+			return fmt.Errorf("%s: unknown setting %q", file, key)
+		}
+		if explicit[key] {
+			continue
+		}
+		values, ok := raw[key].([]any)
+		if !ok {
+			values = []any{raw[key]}
+		}
+		for _, v := range values {
+			s, err := configValue(v)
+			if err != nil {
+				return fmt.Errorf("%s: %s: %v", file, key, err)
+			}
+			if err := fs.Set(key, s); err != nil {
+				return fmt.Errorf("%s: %s: %v", file, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValue renders a config file value the way it would be typed on the
+// command line.
+func configValue(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("want a string, number, boolean or list of them, got %v", v)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// corsMethods is advertised on every preflight. TRACE operations are routed
+// too but left out: browsers refuse to send TRACE from scripts, so no
+// preflight ever asks for it.
+const corsMethods = "GET,POST,PUT,PATCH,DELETE,HEAD,OPTIONS"
+
+// corsMiddleware answers preflights and decorates actual responses with the
+// CORS headers configured by --cors and friends.
+func corsMiddleware(opts *Options) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		origin := c.Get(fiber.HeaderOrigin)
+		if origin == "" || !originAllowed(origin, opts.CORSOrigins) {
+			return c.Next()
+		}
+
+		// With credentials the spec forbids "*", so the origin is echoed.
+		// The same applies when only specific origins are allowed.
+		if opts.CORSCredentials || !allowsAnyOrigin(opts.CORSOrigins) {
+			c.Set(fiber.HeaderAccessControlAllowOrigin, origin)
+			c.Vary(fiber.HeaderOrigin)
+		} else {
+			c.Set(fiber.HeaderAccessControlAllowOrigin, "*")
+		}
+		if opts.CORSCredentials {
+			c.Set(fiber.HeaderAccessControlAllowCredentials, "true")
+		}
+
+		if c.Method() != fiber.MethodOptions || c.Get(fiber.HeaderAccessControlRequestMethod) == "" {
+			return c.Next()
+		}
+
+		// ── Preflight ──────────────────────────────────────────────────
+		c.Set(fiber.HeaderAccessControlAllowMethods, corsMethods)
+		headers := opts.CORSHeaders
+		if headers == "" {
+			headers = c.Get(fiber.HeaderAccessControlRequestHeaders)
+			c.Vary(fiber.HeaderAccessControlRequestHeaders)
+		}
+		if headers != "" {
+			c.Set(fiber.HeaderAccessControlAllowHeaders, headers)
+		}
+		if opts.CORSMaxAge > 0 {
+			c.Set(fiber.HeaderAccessControlMaxAge, strconv.Itoa(opts.CORSMaxAge))
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+func allowsAnyOrigin(allowed []string) bool {
+	for _, o := range allowed {
+		if o == "*" {
+			return true
+		}
+	}
+	return len(allowed) == 0
+}
+
+func originAllowed(origin string, allowed []string) bool {
+	if allowsAnyOrigin(allowed) {
+		return true
+	}
+	for _, o := range allowed {
+		if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
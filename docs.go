@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gofiber/fiber/v2"
+)
+
+// assets holds the Swagger UI shell and, under assets/swagger-ui, the files
+// of the pinned swagger-ui-dist release (5.11.0) it loads, committed with
+// their LICENSE so /docs works without internet access.
+//
+//go:embed assets
+var assets embed.FS
+
+// swaggerUIFiles are the swagger-ui-dist files the docs page loads.
+var swaggerUIFiles = []string{"swagger-ui.css", "swagger-ui-bundle.js"}
+
+// registerDocsRoute serves Swagger UI at docsPath, pointed at the spec served
+// by --expose-spec, with its files next to it, e.g. /docs/swagger-ui.css.
+// Like the spec routes it is mounted ahead of the spec's own paths.
+func registerDocsRoute(app *fiber.App, doc *openapi3.T, docsPath string) {
+	if doc.Paths.Find(docsPath) != nil {
+		log.Printf("⚠️  The spec defines %s; it is shadowed by --docs", docsPath)
+	}
+
+	title := "API docs"
+	if doc.Info != nil && doc.Info.Title != "" {
+		title = doc.Info.Title
+	}
+	base := strings.TrimSuffix(docsPath, "/")
+
+	shell, err := assets.ReadFile("assets/docs.html")
+	if err != nil {
+		log.Fatalf("failed to read docs page: %v", err)
+	}
+	var buf bytes.Buffer
+	tmpl := template.Must(template.New("docs").Parse(string(shell)))
+	if err := tmpl.Execute(&buf, map[string]string{"Title": title, "SpecURL": specJSONPath, "AssetsURL": base}); err != nil {
+		log.Fatalf("failed to render docs page: %v", err)
+	}
+	page := buf.Bytes()
+
+	app.Get(docsPath, func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.Send(page)
+	})
+
+	for _, name := range swaggerUIFiles {
+		body, err := assets.ReadFile("assets/swagger-ui/" + name)
+		if err != nil {
+			log.Fatalf("--docs: Swagger UI is missing from this build: %v", err)
+		}
+		ext := strings.TrimPrefix(path.Ext(name), ".")
+		app.Get(base+"/"+name, func(c *fiber.Ctx) error {
+			c.Type(ext, "utf-8")
+			return c.Send(body)
+		})
+	}
+}
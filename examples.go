@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// checkExamples validates every request and response example in doc against
+// the schema declared next to it, logs each mismatch and returns how many
+// were found.
+func checkExamples(doc *openapi3.T) int {
+	var problems []string
+
+	for path, item := range doc.Paths {
+		for method, op := range item.Operations() {
+			where := method + " " + path
+			if op.RequestBody != nil && op.RequestBody.Value != nil {
+				problems = append(problems, checkContentExamples(where+" request", op.RequestBody.Value.Content)...)
+			}
+			for code, ref := range op.Responses {
+				if ref == nil || ref.Value == nil {
+					continue
+				}
+				problems = append(problems, checkContentExamples(where+" response "+code, ref.Value.Content)...)
+			}
+		}
+	}
+
+	sort.Strings(problems)
+	for _, p := range problems {
+		log.Printf("⚠️  Example mismatch: %s", p)
+	}
+	if len(problems) == 0 {
+		log.Println("✅ All examples match their schemas")
+	}
+	return len(problems)
+}
+
+// checkContentExamples validates the example and named examples of each
+// media type in content.
+func checkContentExamples(where string, content openapi3.Content) []string {
+	var problems []string
+	for ct, mt := range content {
+		if mt == nil || mt.Schema == nil || mt.Schema.Value == nil {
+			continue
+		}
+		schema := mt.Schema.Value
+		if mt.Example != nil {
+			for _, v := range checkExample(mt.Example, schema) {
+				problems = append(problems, fmt.Sprintf("%s %s example: %s", where, ct, v))
+			}
+		}
+		for name, ex := range mt.Examples {
+			if ex == nil || ex.Value == nil || ex.Value.Value == nil {
+				continue
+			}
+			for _, v := range checkExample(ex.Value.Value, schema) {
+				problems = append(problems, fmt.Sprintf("%s %s example %q: %s", where, ct, name, v))
+			}
+		}
+	}
+	return problems
+}
+
+// checkExample runs an example value through the same checks used for
+// request bodies. Arrays are checked item by item against the items schema.
+func checkExample(value any, schema *openapi3.Schema) []string {
+	if items, ok := value.([]any); ok && schema.Type == "array" {
+		if schema.Items == nil || schema.Items.Value == nil {
+			return nil
+		}
+		var problems []string
+		for i, item := range items {
+			for _, v := range checkExample(item, schema.Items.Value) {
+				problems = append(problems, fmt.Sprintf("[%d] %s", i, v))
+			}
+		}
+		return problems
+	}
+
+	if _, ok := value.(map[string]any); !ok {
+		if err := checkType("example", value, schema); err != nil {
+			return []string{err.Error()}
+		}
+		return nil
+	}
+
+	violations := validateBody(value, schema)
+	for i, v := range violations {
+		v = strings.TrimPrefix(v, "request.body ")
+		violations[i] = strings.Replace(v, "Request body must", "Example must", 1)
+	}
+	return violations
+}
+
+// Where a mock response body came from, highest precedence first. See
+// resolveResponseBody.
+const (
+	sourceStore     = "stored data"
+	sourceExamples  = "named example"
+	sourceExample   = "example"
+	sourceSchema    = "schema example"
+	sourceGenerated = "generated data"
+	sourceEmpty     = "empty"
+)
+
+// resolvedBody is a response body taken from the spec rather than the store.
+type resolvedBody struct {
+	Source      string
+	Status      int
+	ContentType string
+	Value       any
+	Language    string // set when the example was picked by Accept-Language
+}
+
+// send writes the body. Strings under a binary media type such as
+// image/png are base64-decoded, other strings under a non-JSON media type
+// are sent as they are, and everything else is encoded as JSON. GETs may
+// ask for part of it with a Range header.
+func (b resolvedBody) send(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, b.ContentType)
+	if b.Language != "" {
+		c.Set(fiber.HeaderContentLanguage, b.Language)
+	}
+	if data, ok := b.Value.([]byte); ok {
+		return sendBytes(c, b.Status, data)
+	}
+	if text, ok := b.Value.(string); ok && isBinaryMediaType(b.ContentType) {
+		if data, ok := decodeBinaryExample(text); ok {
+			return sendBytes(c, b.Status, data)
+		}
+	}
+	if text, ok := b.Value.(string); ok && !isJSONMediaType(b.ContentType) {
+		return sendBytes(c, b.Status, []byte(text))
+	}
+	if items, ok := b.Value.([]any); ok && parseMediaType(b.ContentType) == parseMediaType(mimeNDJSON) {
+		var buf bytes.Buffer
+		for _, item := range items {
+			line, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+		return sendBytes(c, b.Status, buf.Bytes())
+	}
+	v, err := json.Marshal(b.Value)
+	if err != nil {
+		return err
+	}
+	return sendBytes(c, b.Status, v)
+}
+
+// resolveResponseBody decides what a request is answered with, in this
+// order:
+//
+//  1. stored data: mutations always, reads once the resource holds records
+//     (loaded from --data or created by a write)
+//  2. the named example picked with "Prefer: example=<name>"
+//  3. the named example for the best Accept-Language match, e.g. "fr"
+//  4. the media type's example
+//  5. its first named example
+//  6. its schema's example
+//  7. empty: the store answers from an empty collection
+//
+// On reads, "Prefer: dynamic=true" puts data generated from the response
+// schema ahead of all of these, drawn from rng when X-Mock-Seed set one:
+// the header asks for fresh data whatever the store or the examples hold,
+// so generated data can't wait behind them. Mutations ignore it so the
+// store still sees the write. Sources 1 and 7 leave the response to the
+// store. The choice depends on the request's headers, hence c, and on
+// nothing in Options.
+func resolveResponseBody(c *fiber.Ctx, op *openapi3.Operation, status int, store *Store, resource string, rng *rand.Rand) resolvedBody {
+	status, resp := operationResponse(op, status)
+
+	method := c.Method()
+	if method != fiber.MethodGet && method != fiber.MethodHead {
+		return resolvedBody{Source: sourceStore}
+	}
+	if preferences(c.Get(headerPrefer))["dynamic"] == "true" {
+		// Binary responses keep their example; without one, a placeholder
+		// image stands in for generated data.
+		if contentType, ok := responseContentType(resp, c.Get(fiber.HeaderAccept)); ok && isBinaryMediaType(contentType) {
+			if body, ok := responseExample(c, resp); ok {
+				body.Status = status
+				return body
+			}
+			if img, ok := placeholderImage(contentType); ok {
+				return resolvedBody{Source: sourceGenerated, Status: status, ContentType: contentType, Value: img}
+			}
+		}
+		if contentType, schema, ok := responseSchema(resp, c.Get(fiber.HeaderAccept)); ok {
+			return resolvedBody{Source: sourceGenerated, Status: status, ContentType: contentType, Value: generateFromSchema(schema, rng)}
+		}
+	}
+
+	if hasRecords(store, resource) {
+		return resolvedBody{Source: sourceStore}
+	}
+	if body, ok := responseExample(c, resp); ok {
+		body.Status = status
+		return body
+	}
+	return resolvedBody{Source: sourceEmpty}
+}
+
+// hasRecords reports whether the store holds any records for resource.
+func hasRecords(store *Store, resource string) bool {
+	col := store.Lookup(resource)
+	if col == nil {
+		return false
+	}
+	col.RLock()
+	defer col.RUnlock()
+	return len(col.Records) > 0
+}
+
+// responseExample picks the example to send for a response from the media
+// type chosen by responseContentType: the one named by "Prefer: example=",
+// then the one named after the best Accept-Language match, then the media
+// type's example, its first named example and its schema's example.
+func responseExample(c *fiber.Ctx, resp *openapi3.Response) (resolvedBody, bool) {
+	contentType, ok := responseContentType(resp, c.Get(fiber.HeaderAccept))
+	if !ok {
+		return resolvedBody{}, false
+	}
+
+	mt := resp.Content[contentType]
+	if mt == nil {
+		return resolvedBody{}, false
+	}
+	named := func(name string) (any, bool) {
+		if ref := mt.Examples[name]; ref != nil && ref.Value != nil && ref.Value.Value != nil {
+			return ref.Value.Value, true
+		}
+		return nil, false
+	}
+	if name := preferences(c.Get(headerPrefer))["example"]; name != "" {
+		if v, ok := named(name); ok {
+			return resolvedBody{Source: sourceExamples, ContentType: contentType, Value: v}, true
+		}
+	}
+	if accept := c.Get(fiber.HeaderAcceptLanguage); accept != "" && len(mt.Examples) > 0 {
+		names := make([]string, 0, len(mt.Examples))
+		for name := range mt.Examples {
+			names = append(names, name)
+		}
+		if lang, ok := matchLanguage(accept, names); ok {
+			if v, ok := named(lang); ok {
+				return resolvedBody{Source: sourceExamples, ContentType: contentType, Value: v, Language: lang}, true
+			}
+		}
+	}
+	if v, source, ok := mediaTypeExample(mt); ok {
+		return resolvedBody{Source: source, ContentType: contentType, Value: v}, true
+	}
+	return resolvedBody{}, false
+}
+
+// mediaTypeExample returns a media type's example, its first named example
+// or its schema's example, whichever comes first, and where it came from.
+func mediaTypeExample(mt *openapi3.MediaType) (any, string, bool) {
+	switch {
+	case mt == nil:
+		return nil, "", false
+	case mt.Example != nil:
+		return mt.Example, sourceExample, true
+	case len(mt.Examples) > 0:
+		names := make([]string, 0, len(mt.Examples))
+		for name := range mt.Examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if ref := mt.Examples[names[0]]; ref != nil && ref.Value != nil && ref.Value.Value != nil {
+			return ref.Value.Value, sourceExamples, true
+		}
+	case mt.Schema != nil && mt.Schema.Value != nil && mt.Schema.Value.Example != nil:
+		return mt.Schema.Value.Example, sourceSchema, true
+	}
+	return nil, "", false
+}
+
+// offeredContentTypes lists the media types a response can be sent as, JSON
+// types first. Responses that declare no content are served from the store,
+// which speaks JSON.
+func offeredContentTypes(resp *openapi3.Response) []string {
+	if resp == nil || len(resp.Content) == 0 {
+		return []string{fiber.MIMEApplicationJSON}
+	}
+	var jsonTypes, others []string
+	for _, ct := range sortedContentTypes(resp.Content) {
+		if isJSONMediaType(ct) {
+			jsonTypes = append(jsonTypes, ct)
+		} else {
+			others = append(others, ct)
+		}
+	}
+	return append(jsonTypes, others...)
+}
+
+// responseContentType picks which of resp's declared media types to answer
+// with: the one the Accept header weighs highest, preferring JSON.
+func responseContentType(resp *openapi3.Response, accept string) (string, bool) {
+	if resp == nil || len(resp.Content) == 0 {
+		return "", false
+	}
+	return negotiate(accept, offeredContentTypes(resp))
+}
+
+// operationResponse returns the response an operation declares for status,
+// or its first success response, along with the status to send it with.
+func operationResponse(op *openapi3.Operation, status int) (int, *openapi3.Response) {
+	if resp, ok := declaredResponse(op, status); ok {
+		return status, resp
+	}
+	if code, resp, ok := successResponse(op); ok {
+		return code, resp
+	}
+	return status, nil
+}
+
+// declaredResponse finds the response an operation declares for status,
+// either under its exact code or a range such as "5XX".
+func declaredResponse(op *openapi3.Operation, status int) (*openapi3.Response, bool) {
+	if op == nil {
+		return nil, false
+	}
+	code := strconv.Itoa(status)
+	for _, key := range []string{code, code[:1] + "XX"} {
+		if ref := op.Responses[key]; ref != nil && ref.Value != nil {
+			return ref.Value, true
+		}
+	}
+	return nil, false
+}
+
+// successResponse returns the first 2xx response an operation declares,
+// falling back to "default" (served as 200).
+func successResponse(op *openapi3.Operation) (int, *openapi3.Response, bool) {
+	if op == nil {
+		return 0, nil, false
+	}
+	for _, code := range sortedResponseCodes(op.Responses) {
+		ref := op.Responses[code]
+		if ref == nil || ref.Value == nil {
+			continue
+		}
+		if code == "default" {
+			return 200, ref.Value, true
+		}
+		if status, err := strconv.Atoi(code); err == nil && status >= 200 && status < 300 {
+			return status, ref.Value, true
+		}
+	}
+	return 0, nil, false
+}
+
+// responseSchema returns the schema of the media type chosen by
+// responseContentType.
+func responseSchema(resp *openapi3.Response, accept string) (string, *openapi3.Schema, bool) {
+	contentType, ok := responseContentType(resp, accept)
+	if !ok {
+		return "", nil, false
+	}
+	mt := resp.Content[contentType]
+	if mt == nil || mt.Schema == nil || mt.Schema.Value == nil {
+		return "", nil, false
+	}
+	return contentType, mt.Schema.Value, true
+}
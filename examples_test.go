@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestDynamicPreferenceStillWritesToTheStore(t *testing.T) {
+	app := newTestApp(t, testSpec, "", nil)
+
+	resp, body := send(t, app, "POST", "/users", `{"name":"Ann"}`, headerPrefer, "dynamic=true")
+	if resp.StatusCode != 201 {
+		t.Fatalf("POST: got %d %s", resp.StatusCode, body)
+	}
+	if got := decode[map[string]any](t, body)["name"]; got != "Ann" {
+		t.Errorf("POST answered with %s, not the created record", body)
+	}
+
+	resp, body = send(t, app, "GET", "/users/1", "")
+	if resp.StatusCode != 200 || decode[map[string]any](t, body)["name"] != "Ann" {
+		t.Fatalf("GET /users/1 after a dynamic POST: got %d %s", resp.StatusCode, body)
+	}
+
+	// Reads still get generated data.
+	resp, _ = send(t, app, "GET", "/users/1", "", headerPrefer, "dynamic=true")
+	if got := resp.Header.Get(headerPreferenceApplied); got != "dynamic=true" {
+		t.Errorf("dynamic GET: %s = %q, want dynamic=true", headerPreferenceApplied, got)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Vendor extensions understood by the mock.
+const (
+	extSequence = "x-mock-sequence"
+	extTemplate = "x-mock-template"
+	extEcho     = "x-mock-echo"
+	extComputed = "x-mock-computed"
+	extMatchers = "x-mock-matchers"
+
+	extStatusWeights = "x-mock-status-weights"
+	extResource      = "x-mock-resource"
+	extFilename      = "x-mock-filename"
+)
+
+// mockTemplates holds the parsed x-mock-template of every response. It is
+// filled once by compileExtensions and only read afterwards.
+var mockTemplates = map[*openapi3.Response]*template.Template{}
+
+// mockComputed holds the parsed x-mock-computed fields of every operation,
+// filled alongside mockTemplates.
+var mockComputed = map[*openapi3.Operation][]computedField{}
+
+// computedField is one x-mock-computed entry: a record field and the
+// template that renders it.
+type computedField struct {
+	Name string
+	Tmpl *template.Template
+}
+
+// computedFuncs are available to x-mock-computed templates.
+var computedFuncs = template.FuncMap{
+	"slug":  slugify,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// mockSequence returns the status and payloads of the first response that
+// declares x-mock-sequence, checking responses in status-code order.
+// A "default" response is served as 200.
+func mockSequence(op *openapi3.Operation) (int, []any) {
+	if op == nil {
+		return 0, nil
+	}
+	for _, code := range sortedResponseCodes(op.Responses) {
+		ref := op.Responses[code]
+		if ref == nil || ref.Value == nil {
+			continue
+		}
+		seq, ok := ref.Value.Extensions[extSequence].([]any)
+		if !ok || len(seq) == 0 {
+			continue
+		}
+		status, err := strconv.Atoi(code)
+		if err != nil {
+			status = 200
+		}
+		return status, seq
+	}
+	return 0, nil
+}
+
+// sortedResponseCodes lists response keys with numeric codes first.
+func sortedResponseCodes(responses openapi3.Responses) []string {
+	codes := make([]string, 0, len(responses))
+	for code := range responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes) // digits sort before "default"
+	return codes
+}
+
+// echoConfig is the parsed form of x-mock-echo.
+type echoConfig struct {
+	Status int    // response status, 200 unless configured
+	Wrap   string // when set, the body is returned as {Wrap: body}
+}
+
+// mockEcho reads x-mock-echo from an operation. It accepts either `true` or
+// an object such as {status: 202, wrap: data}.
+func mockEcho(op *openapi3.Operation) (echoConfig, bool) {
+	cfg := echoConfig{Status: 200}
+	if op == nil {
+		return cfg, false
+	}
+	switch v := op.Extensions[extEcho].(type) {
+	case bool:
+		return cfg, v
+	case map[string]any:
+		if status, ok := v["status"].(float64); ok {
+			cfg.Status = int(status)
+		}
+		if wrap, ok := v["wrap"].(string); ok {
+			cfg.Wrap = wrap
+		}
+		return cfg, true
+	}
+	return cfg, false
+}
+
+// compileExtensions checks and parses the x-mock-* extensions in doc that
+// need it: x-mock-resource names, x-mock-computed, x-mock-matchers,
+// x-mock-status-weights and x-mock-template. Mistakes are reported at
+// startup rather than on the first request.
+func compileExtensions(doc *openapi3.T) error {
+	for path, item := range doc.Paths {
+		if err := checkResourceName(path, item.Extensions); err != nil {
+			return err
+		}
+		for method, op := range item.Operations() {
+			if err := checkResourceName(method+" "+path, op.Extensions); err != nil {
+				return err
+			}
+			if err := compileComputed(method+" "+path, op); err != nil {
+				return err
+			}
+			if err := compileMatchers(method+" "+path, op); err != nil {
+				return err
+			}
+			if err := compileStatusWeights(method+" "+path, op); err != nil {
+				return err
+			}
+			for code, ref := range op.Responses {
+				if ref == nil || ref.Value == nil {
+					continue
+				}
+				raw, ok := ref.Value.Extensions[extTemplate]
+				if !ok {
+					continue
+				}
+				src, ok := raw.(string)
+				if !ok {
+					return fmt.Errorf("%s %s response %s: %s must be a string", method, path, code, extTemplate)
+				}
+				t, err := template.New(method + " " + path + " " + code).Parse(src)
+				if err != nil {
+					return fmt.Errorf("%s %s response %s: %s: %w", method, path, code, extTemplate, err)
+				}
+				mockTemplates[ref.Value] = t
+			}
+		}
+	}
+	return nil
+}
+
+// checkResourceName rejects an x-mock-resource that can't name a store
+// collection.
+func checkResourceName(where string, ext map[string]any) error {
+	raw, ok := ext[extResource]
+	if !ok {
+		return nil
+	}
+	if name, ok := raw.(string); !ok || name == "" || strings.ContainsAny(name, "/{}") {
+		return fmt.Errorf("%s: %s must be a collection name such as users, got %v", where, extResource, raw)
+	}
+	return nil
+}
+
+// compileComputed parses an operation's x-mock-computed, a map from field
+// name to template, e.g. {slug: "{{slug .title}}"}.
+func compileComputed(where string, op *openapi3.Operation) error {
+	raw, ok := op.Extensions[extComputed]
+	if !ok {
+		return nil
+	}
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s: %s must map field names to templates", where, extComputed)
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	computed := make([]computedField, 0, len(names))
+	for _, name := range names {
+		src, ok := fields[name].(string)
+		if !ok {
+			return fmt.Errorf("%s: %s.%s must be a string", where, extComputed, name)
+		}
+		t, err := template.New(where + " " + name).Funcs(computedFuncs).Parse(src)
+		if err != nil {
+			return fmt.Errorf("%s: %s.%s: %w", where, extComputed, name, err)
+		}
+		computed = append(computed, computedField{Name: name, Tmpl: t})
+	}
+	mockComputed[op] = computed
+	return nil
+}
+
+// applyComputed renders op's x-mock-computed fields into record. Every
+// template sees the record as it was before any of them ran.
+func applyComputed(op *openapi3.Operation, record map[string]any) error {
+	fields := mockComputed[op]
+	if len(fields) == 0 {
+		return nil
+	}
+	snapshot := make(map[string]any, len(record))
+	for k, v := range record {
+		snapshot[k] = v
+	}
+	for _, f := range fields {
+		var buf strings.Builder
+		if err := f.Tmpl.Execute(&buf, snapshot); err != nil {
+			return fmt.Errorf("%s.%s: %w", extComputed, f.Name, err)
+		}
+		record[f.Name] = buf.String()
+	}
+	return nil
+}
+
+// slugify lowercases s and joins its letters and digits with hyphens:
+// "Hello, World!" becomes "hello-world".
+func slugify(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	return b.String()
+}
+
+// mockTemplate returns the status, content type and compiled template of the
+// first response declaring x-mock-template.
+func mockTemplate(op *openapi3.Operation) (int, string, *template.Template) {
+	if op == nil {
+		return 0, "", nil
+	}
+	for _, code := range sortedResponseCodes(op.Responses) {
+		ref := op.Responses[code]
+		if ref == nil || ref.Value == nil {
+			continue
+		}
+		t, ok := mockTemplates[ref.Value]
+		if !ok {
+			continue
+		}
+		status, err := strconv.Atoi(code)
+		if err != nil {
+			status = 200
+		}
+		contentType := fiber.MIMEApplicationJSON
+		if types := sortedContentTypes(ref.Value.Content); len(types) > 0 {
+			contentType = types[0]
+		}
+		return status, contentType, t
+	}
+	return 0, "", nil
+}
+
+// templateContext exposes the request to x-mock-template as .params, .query,
+// .headers, .body (the parsed JSON body), .now (RFC 3339) and .operationId.
+func templateContext(c *fiber.Ctx, op *openapi3.Operation, body any) map[string]any {
+	headers := map[string]string{}
+	for k, v := range c.GetReqHeaders() {
+		if len(v) > 0 {
+			headers[k] = v[0]
+		}
+	}
+
+	return map[string]any{
+		"params":      c.AllParams(),
+		"query":       c.Queries(),
+		"headers":     headers,
+		"body":        body,
+		"now":         time.Now().UTC().Format(time.RFC3339),
+		"operationId": op.OperationID,
+	}
+}
+
+func sortedContentTypes(content openapi3.Content) []string {
+	types := make([]string, 0, len(content))
+	for ct := range content {
+		types = append(types, ct)
+	}
+	sort.Strings(types)
+	return types
+}
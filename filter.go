@@ -0,0 +1,202 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// filterOps are the json-server style suffixes understood on collection
+// query keys, e.g. ?price_gte=10 or ?name_like=^a.
+var filterOps = []string{"_gte", "_lte", "_gt", "_lt", "_ne", "_like"}
+
+// recordFilter is one field condition taken from the query string.
+type recordFilter struct {
+	field string
+	op    string // "" for exact match, otherwise one of filterOps
+	value string
+	re    *regexp.Regexp // compiled value for _like
+}
+
+// parseFilters turns collection query parameters into record filters. Keys
+// starting with "_" are reserved for other features and skipped; keys without
+// a known operator suffix are exact matches on the field of that name.
+func parseFilters(query map[string]string) ([]recordFilter, error) {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		if !strings.HasPrefix(k, "_") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	filters := make([]recordFilter, 0, len(keys))
+	for _, key := range keys {
+		f := recordFilter{field: key, value: query[key]}
+		for _, op := range filterOps {
+			if field, ok := strings.CutSuffix(key, op); ok && field != "" {
+				f.field, f.op = field, op
+				break
+			}
+		}
+		if f.op == "_like" {
+			re, err := regexp.Compile("(?i)" + f.value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s pattern %q", key, f.value)
+			}
+			f.re = re
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// nonFilterParams returns the query parameters of a collection GET that
+// aren't record filters: apiKey credentials, and declared parameters such as
+// q or sort that don't name a field of the collection's items. Declared
+// parameters are only told apart when the response schema lists the item
+// fields; otherwise they filter like any other key.
+func nonFilterParams(specPath string, op *openapi3.Operation) []string {
+	if op == nil {
+		return nil
+	}
+	names := credentialQueryParams(op)
+	fields := itemFields(op)
+	if len(fields) == 0 {
+		return names
+	}
+	params := op.Parameters
+	if item := openapiDoc.Paths[specPath]; item != nil {
+		params = append(params[:len(params):len(params)], item.Parameters...)
+	}
+	for _, ref := range params {
+		if ref.Value == nil || ref.Value.In != "query" {
+			continue
+		}
+		field := ref.Value.Name
+		for _, op := range filterOps {
+			if f, ok := strings.CutSuffix(field, op); ok && f != "" {
+				field = f
+				break
+			}
+		}
+		if _, ok := fields[field]; !ok {
+			names = append(names, ref.Value.Name)
+		}
+	}
+	return names
+}
+
+// itemFields returns the properties of the items op's success response
+// lists, either as a bare array or under "data" as --envelope and cursor
+// pages send them. It is nil when the spec doesn't say.
+func itemFields(op *openapi3.Operation) map[string]*openapi3.Schema {
+	_, resp, ok := successResponse(op)
+	if !ok {
+		return nil
+	}
+	schema := mediaTypeSchema(jsonMediaType(resp))
+	if schema != nil && schema.Items == nil {
+		if data := schema.Properties["data"]; data != nil && data.Value != nil {
+			schema = data.Value
+		}
+	}
+	if schema == nil || schema.Items == nil || schema.Items.Value == nil {
+		return nil
+	}
+	_, props := collectSchemaConstraints(schema.Items.Value)
+	return props
+}
+
+// filterRecords returns the records matching every filter. The input slice
+// is left untouched.
+func filterRecords(records []map[string]any, filters []recordFilter) []map[string]any {
+	if len(filters) == 0 {
+		return records
+	}
+	out := make([]map[string]any, 0, len(records))
+	for _, record := range records {
+		if matchesFilters(record, filters) {
+			out = append(out, record)
+		}
+	}
+	return out
+}
+
+func matchesFilters(record map[string]any, filters []recordFilter) bool {
+	for _, f := range filters {
+		if !f.match(record) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f recordFilter) match(record map[string]any) bool {
+	v, ok := record[f.field]
+	if !ok || v == nil {
+		// A missing field is only "not equal" to anything.
+		return f.op == "_ne"
+	}
+
+	switch f.op {
+	case "_like":
+		return f.re.MatchString(fmt.Sprint(v))
+	case "_ne":
+		c, ok := compareValue(v, f.value)
+		return !ok || c != 0
+	}
+
+	c, ok := compareValue(v, f.value)
+	if !ok {
+		return false
+	}
+	switch f.op {
+	case "_gte":
+		return c >= 0
+	case "_lte":
+		return c <= 0
+	case "_gt":
+		return c > 0
+	case "_lt":
+		return c < 0
+	}
+	return c == 0
+}
+
+// compareValue compares a record value with a query string value: numbers
+// numerically, booleans by truth value, anything else as text. ok is false
+// when the query value can't be read as the record value's type.
+func compareValue(v any, q string) (int, bool) {
+	switch x := v.(type) {
+	case float64:
+		n, err := strconv.ParseFloat(q, 64)
+		if err != nil {
+			return 0, false
+		}
+		return cmp.Compare(x, n), true
+	case int:
+		n, err := strconv.ParseFloat(q, 64)
+		if err != nil {
+			return 0, false
+		}
+		return cmp.Compare(float64(x), n), true
+	case bool:
+		b, err := strconv.ParseBool(q)
+		if err != nil {
+			return 0, false
+		}
+		if x == b {
+			return 0, true
+		}
+		return 1, true
+	case string:
+		return strings.Compare(x, q), true
+	}
+	return strings.Compare(fmt.Sprint(v), q), true
+}
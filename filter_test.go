@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// filterSpec secures GET /users with an apiKey in the query and declares q
+// and sort alongside the name field.
+const filterSpec = `openapi: 3.0.3
+info: {title: test, version: "1"}
+security:
+  - apiKey: []
+paths:
+  /users:
+    get:
+      parameters:
+        - {name: q, in: query, schema: {type: string}}
+        - {name: sort, in: query, schema: {type: string}}
+        - {name: name, in: query, schema: {type: string}}
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  type: object
+                  properties:
+                    id: {type: integer}
+                    name: {type: string}
+components:
+  securitySchemes:
+    apiKey: {type: apiKey, in: query, name: api_key}
+`
+
+func TestFiltersSkipCredentialsAndNonFieldParams(t *testing.T) {
+	app := newTestApp(t, filterSpec, `{"users": [{"id": 1, "name": "Ann"}, {"id": 2, "name": "Bob"}]}`, nil)
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"api_key=secret", 2},
+		{"api_key=secret&q=ann&sort=name", 2},
+		{"api_key=secret&name=Ann", 1},
+		{"api_key=secret&name=Ann&sort=name", 1},
+		{"api_key=secret&undeclared=x", 0},
+	}
+	for _, tt := range tests {
+		resp, body := send(t, app, "GET", "/users?"+tt.query, "")
+		if resp.StatusCode != 200 {
+			t.Errorf("%s: got %d %s", tt.query, resp.StatusCode, body)
+			continue
+		}
+		if n := len(decode[[]any](t, body)); n != tt.want {
+			t.Errorf("%s: got %d users, want %d: %s", tt.query, n, tt.want, strings.TrimSpace(body))
+		}
+	}
+
+	if resp, _ := send(t, app, "GET", "/users", ""); resp.StatusCode != 401 {
+		t.Errorf("without api_key: got %d, want 401", resp.StatusCode)
+	}
+}
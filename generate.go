@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// fakerRand drives generated data. rand.Rand isn't safe for concurrent use,
+// so it is only touched under fakerMu. It is time-seeded unless --faker-seed
+// is given.
+var (
+	fakerMu   sync.Mutex
+	fakerRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+var fakerWords = []string{
+	"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel",
+	"india", "juliet", "kilo", "lima", "mike", "november", "oscar", "papa",
+}
+
+// seedFaker makes generated data reproducible: the same seed and the same
+// sequence of requests produce the same values on every run.
+func seedFaker(seed int64) {
+	fakerMu.Lock()
+	defer fakerMu.Unlock()
+	fakerRand = rand.New(rand.NewSource(seed))
+}
+
+// generateFromSchema builds a random value that fits schema, ignoring any
+// examples it declares. A non-nil rng stands in for fakerRand.
+func generateFromSchema(schema *openapi3.Schema, rng *rand.Rand) any {
+	fakerMu.Lock()
+	defer fakerMu.Unlock()
+	if rng != nil {
+		defer func(shared *rand.Rand) { fakerRand = shared }(fakerRand)
+		fakerRand = rng
+	}
+	v, _ := generateValue(schema, map[*openapi3.Schema]bool{})
+	return v
+}
+
+// generateValue returns a value for schema. ok is false when schema is
+// already being generated further up, i.e. it refers to itself; such
+// properties and array items are left out rather than recursing forever.
+func generateValue(schema *openapi3.Schema, active map[*openapi3.Schema]bool) (v any, ok bool) {
+	if schema == nil {
+		return nil, true
+	}
+	if active[schema] {
+		return nil, false
+	}
+	active[schema] = true
+	defer delete(active, schema)
+
+	switch {
+	case len(schema.AllOf) > 0:
+		merged := map[string]any{}
+		for _, sub := range schema.AllOf {
+			if obj, ok := generateValue(sub.Value, active); ok {
+				if obj, isObj := obj.(map[string]any); isObj {
+					for k, v := range obj {
+						merged[k] = v
+					}
+				}
+			}
+		}
+		return merged, true
+	case len(schema.OneOf) > 0:
+		return generateValue(schema.OneOf[0].Value, active)
+	case len(schema.AnyOf) > 0:
+		return generateValue(schema.AnyOf[0].Value, active)
+	}
+
+	if len(schema.Enum) > 0 {
+		return schema.Enum[fakerRand.Intn(len(schema.Enum))], true
+	}
+
+	switch schema.Type {
+	case "object":
+		return generateObject(schema, active), true
+	case "array":
+		n := 1 + fakerRand.Intn(3)
+		items := make([]any, 0, n)
+		if schema.Items != nil {
+			for i := 0; i < n; i++ {
+				if item, ok := generateValue(schema.Items.Value, active); ok {
+					items = append(items, item)
+				}
+			}
+		}
+		return items, true
+	case "integer":
+		return generateInteger(schema), true
+	case "number":
+		return generateNumber(schema), true
+	case "boolean":
+		return fakerRand.Intn(2) == 1, true
+	case "string":
+		return generateString(schema), true
+	}
+	if len(schema.Properties) > 0 {
+		return generateObject(schema, active), true
+	}
+	return nil, true
+}
+
+// generateObject fills every declared property, in name order.
+func generateObject(schema *openapi3.Schema, active map[*openapi3.Schema]bool) map[string]any {
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	obj := make(map[string]any, len(names))
+	for _, name := range names {
+		if ref := schema.Properties[name]; ref != nil {
+			if v, ok := generateValue(ref.Value, active); ok {
+				obj[name] = v
+			}
+		}
+	}
+	return obj
+}
+
+// fakerEpoch anchors generated dates, so a seeded run doesn't depend on the
+// clock.
+var fakerEpoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// generateString produces a value shaped like the schema's format. Unknown
+// formats get plain words, fitted to minLength and maxLength.
+func generateString(schema *openapi3.Schema) string {
+	word := func() string { return fakerWords[fakerRand.Intn(len(fakerWords))] }
+
+	switch schema.Format {
+	case "email":
+		return word() + "." + word() + "@example.com"
+	case "uuid":
+		b := make([]byte, 16)
+		fakerRand.Read(b)
+		b[6] = b[6]&0x0f | 0x40 // version 4
+		b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	case "date-time":
+		return fakerEpoch.Add(time.Duration(fakerRand.Int63n(5*365*24*3600)) * time.Second).Format(time.RFC3339)
+	case "date":
+		return fakerEpoch.AddDate(0, 0, fakerRand.Intn(5*365)).Format(time.DateOnly)
+	case "uri", "url":
+		return "https://example.com/" + word()
+	case "hostname":
+		return word() + ".example.com"
+	case "ipv4":
+		return fmt.Sprintf("192.0.2.%d", 1+fakerRand.Intn(254))
+	}
+
+	s := word()
+	for uint64(len(s)) < schema.MinLength {
+		s += " " + word()
+	}
+	if schema.MaxLength != nil && uint64(len(s)) > *schema.MaxLength {
+		s = strings.TrimSpace(s[:*schema.MaxLength])
+		for uint64(len(s)) < schema.MinLength {
+			s += "x"
+		}
+	}
+	return s
+}
+
+// generateInteger picks a whole number within minimum and maximum, or 1-1000
+// when the schema leaves them open.
+func generateInteger(schema *openapi3.Schema) int {
+	lo, hi := 1, 1000
+	if schema.Min != nil {
+		lo = int(math.Ceil(*schema.Min))
+		if schema.ExclusiveMin && float64(lo) == *schema.Min {
+			lo++
+		}
+		if schema.Max == nil {
+			hi = lo + 999
+		}
+	}
+	if schema.Max != nil {
+		hi = int(math.Floor(*schema.Max))
+		if schema.ExclusiveMax && float64(hi) == *schema.Max {
+			hi--
+		}
+		if schema.Min == nil && hi < lo {
+			lo = hi - 999
+		}
+	}
+	if hi <= lo {
+		return lo
+	}
+	return lo + fakerRand.Intn(hi-lo+1)
+}
+
+// generateNumber picks a number with two decimals within minimum and
+// maximum, or 0-1000 when the schema leaves them open.
+func generateNumber(schema *openapi3.Schema) float64 {
+	lo, hi := 0.0, 1000.0
+	if schema.Min != nil {
+		lo = *schema.Min
+		if schema.Max == nil {
+			hi = lo + 1000
+		}
+	}
+	if schema.Max != nil {
+		hi = *schema.Max
+		if schema.Min == nil && hi < lo {
+			lo = hi - 1000
+		}
+	}
+	if hi <= lo {
+		return lo
+	}
+	n := math.Round((lo+fakerRand.Float64()*(hi-lo))*100) / 100
+	// Rounding can land on an excluded bound; step back inside.
+	if (schema.ExclusiveMin && n <= lo) || n < lo {
+		n = lo + (hi-lo)/2
+	}
+	if (schema.ExclusiveMax && n >= hi) || n > hi {
+		n = lo + (hi-lo)/2
+	}
+	return n
+}
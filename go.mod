@@ -5,6 +5,8 @@ go 1.21
 require (
 	github.com/getkin/kin-openapi v0.121.0
 	github.com/gofiber/fiber/v2 v2.52.0
+	github.com/invopop/yaml v0.2.0
+	github.com/valyala/fasthttp v1.51.0
 )
 
 require (
@@ -13,7 +15,6 @@ require (
 	github.com/go-openapi/swag v0.22.4 // indirect
 	github.com/google/uuid v1.5.0 // indirect
 	github.com/gorilla/mux v1.8.0 // indirect
-	github.com/invopop/yaml v0.2.0 // indirect
 	github.com/josharian/intern v1.0.0 // indirect
 	github.com/klauspost/compress v1.17.0 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
@@ -24,7 +25,6 @@ require (
 	github.com/perimeterx/marshmallow v1.1.5 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
-	github.com/valyala/fasthttp v1.51.0 // indirect
 	github.com/valyala/tcplisten v1.0.0 // indirect
 	golang.org/x/sys v0.15.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
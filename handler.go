@@ -1,13 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
+	"math/rand"
+	"net/url"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
 	"github.com/getkin/kin-openapi/openapi3"
 )
 
@@ -17,10 +25,25 @@ func validationError(c *fiber.Ctx, logger *Logger, statusCode int, errMsg string
 	logger.Error(ComponentValidator, errMsg)
 	logger.RespondWith(statusCode)
 	logger.Violation(errMsg)
-	return c.Status(statusCode).JSON(fiber.Map{
-		"error":   http.StatusText(statusCode),
-		"message": errMsg,
-	})
+	return writeError(c, statusCode, errMsg)
+}
+
+// errorResponse logs and sends an error that isn't a validation failure.
+// Every error the mock produces goes out through writeError, so clients
+// always get the same body shape.
+func errorResponse(c *fiber.Ctx, logger *Logger, statusCode int, message string) error {
+	if statusCode >= 500 {
+		logger.Error(ComponentNegotiator, message)
+	} else {
+		logger.Warning(ComponentNegotiator, message)
+	}
+	logger.RespondWith(statusCode)
+	return writeError(c, statusCode, message)
+}
+
+// notFoundMessage describes a missing record.
+func notFoundMessage(resource, id string) string {
+	return fmt.Sprintf("No %s with id %s", singularize(resource), id)
 }
 
 // bodyValidationError logs every violation on its own line, then responds.
@@ -33,30 +56,98 @@ func bodyValidationError(c *fiber.Ctx, logger *Logger, statusCode int, violation
 	for _, v := range violations {
 		logger.Error(ComponentValidator, "Violation: "+v)
 	}
-	return c.Status(statusCode).JSON(fiber.Map{
-		"error":   http.StatusText(statusCode),
-		"message": strings.Join(violations, "; "),
-	})
+	return writeError(c, statusCode, strings.Join(violations, "; "))
 }
 
-func handle(c *fiber.Ctx, method, resource string, store *Store, dataFile string) error {
-	logger := NewLogger()
+func handle(c *fiber.Ctx, method, specPath string, route routeResource, operation *openapi3.Operation, store *Store, opts *Options) (err error) {
+	resource := route.Name
+	start := time.Now()
+	logger := NewLogger(requestID(c))
+	if operation != nil {
+		logger.operationID = operation.OperationID
+	}
+
+	defer func() {
+		if err == nil && opts.ValidateResponses {
+			if violations := kinValidateResponse(c, method, specPath, operation); len(violations) > 0 {
+				logger.Warning(ComponentValidator, "Response does not match the spec")
+				for _, v := range violations {
+					logger.Error(ComponentValidator, "Violation: "+v)
+				}
+				if opts.InvalidResponses == InvalidResponsesFail {
+					c.Response().Header.Del(fiber.HeaderContentDisposition)
+					err = writeError(c, 500, "The mock's response does not match the spec: "+strings.Join(violations, "; "))
+				}
+			}
+		}
+		status := c.Response().StatusCode()
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			status = fe.Code
+		}
+		elapsed := time.Since(start)
+		logger.Summary(method, c.Path(), status, elapsed)
+		if metrics != nil {
+			metrics.Observe(method, specPath, status, elapsed)
+		}
+		if err == nil {
+			setContentDisposition(c, operation, resource)
+		}
+		if err == nil && opts.Throttle > 0 {
+			throttleBody(c, opts.Throttle)
+		}
+	}()
 
 	// ── Log request received ───────────────────────────────────────────
 	logger.RequestReceived(method, c.Path())
 
+	// X-Mock-Seed swaps the shared random sources for one of its own, so
+	// the request's delay, weighted status and generated data repeat.
+	var rng *rand.Rand
+	if s := c.Get(headerSeed); s != "" {
+		seed, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return errorResponse(c, logger, 400, headerSeed+" must be an integer")
+		}
+		rng = rand.New(rand.NewSource(seed))
+		logger.Info(ComponentNegotiator, fmt.Sprintf("Seeded with %s: %d", headerSeed, seed))
+	}
+
+	if delay := opts.routeDelay(method, specPath, rng); delay > 0 {
+		logger.Info(ComponentHTTPServer, fmt.Sprintf("Delaying the response by %s", delay))
+		time.Sleep(delay)
+	}
+
+	// ── Maintenance mode ───────────────────────────────────────────────
+	if maintenanceMode.Load() {
+		c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(maintenanceRetryAfter.Load(), 10))
+		return errorResponse(c, logger, 503, "Server is in maintenance mode")
+	}
+
+	// ── Read-only mode ─────────────────────────────────────────────────
+	if opts.ReadOnly && isMutating(method) {
+		c.Set(fiber.HeaderAllow, "GET, HEAD, OPTIONS")
+		return errorResponse(c, logger, fiber.StatusMethodNotAllowed, "Server is in read-only mode")
+	}
+
 	if accept := c.Get("Accept"); accept != "" {
 		logger.Info(ComponentNegotiator, fmt.Sprintf("Request contains an accept header: %s", accept))
 	}
 
 	// ── Resolve OpenAPI operation ──────────────────────────────────────
-	routePath := c.Route().Path
-	operation := operationForPathMethod(routePath, method)
+
+	if operation != nil && operation.Deprecated {
+		if opts.RejectDeprecated {
+			return errorResponse(c, logger, fiber.StatusGone, "This operation is deprecated")
+		}
+		c.Set("Deprecation", "true")
+		logger.Warning(ComponentHTTPServer, "Operation is deprecated")
+	}
 
 	// ── STEP 1: Security validation ────────────────────────────────────
 	// Check per-operation security, then fall back to global security.
 	secReqs := resolveSecurityRequirements(operation)
-	if len(secReqs) > 0 {
+	if len(secReqs) > 0 && opts.Validator != ValidatorKin {
 		if !isAuthenticated(c, secReqs) {
 			return validationError(c, logger, 401, "Invalid security scheme used")
 		}
@@ -64,37 +155,58 @@ func handle(c *fiber.Ctx, method, resource string, store *Store, dataFile string
 	}
 
 	// ── STEP 2: Content-Type negotiation ───────────────────────────────
-	if operation != nil && needsRequestBody(method) {
+	// JSON bodies are parsed once, here, so malformed payloads are rejected
+	// whether or not the spec declares a schema, and validation and storage
+	// see the same value.
+	contentType := c.Get(fiber.HeaderContentType)
+	empty := isEmptyBody(c.Body(), contentType)
+	var payload any
+	if needsRequestBody(method) && !empty && isJSONMediaType(contentType) {
+		if err := json.Unmarshal(c.Body(), &payload); err != nil {
+			return validationError(c, logger, 400, fmt.Sprintf("Invalid JSON body: %s", err.Error()))
+		}
+	}
+
+	if operation != nil && needsRequestBody(method) && opts.Validator != ValidatorKin {
 		if operation.RequestBody != nil && operation.RequestBody.Value != nil {
 			rb := operation.RequestBody.Value
 
-			// 2a. Body required but missing
-			if rb.Required && len(c.Body()) == 0 {
-				return validationError(c, logger, 400, "Body parameter is required")
+			// 2a. Body required but missing. Whitespace and a JSON null
+			// count as missing too. An empty object is a body, so it goes
+			// on to the schema checks and reports each missing property.
+			if empty && rb.Required {
+				return validationError(c, logger, 400, "Body parameter is required, but "+emptyBodyReason(c.Body(), contentType))
+			}
+			if empty && opts.RejectEmptyBody {
+				return validationError(c, logger, 400, "Request body is empty: "+emptyBodyReason(c.Body(), contentType))
+			}
+			if empty && len(c.Body()) > 0 {
+				logger.Info(ComponentValidator, "Request body is empty; treating it as {}")
 			}
 
 			// 2b. Content-Type must be acceptable
-			if len(c.Body()) > 0 && rb.Content != nil {
-				ct := c.Get("Content-Type")
+			if !empty && rb.Content != nil {
+				ct := contentType
 				if ct == "" {
 					return validationError(c, logger, 415, "Content-Type header is required")
 				}
-				// Normalise: take everything before ';' for comparison
-				baseCT := strings.Split(ct, ";")[0]
-				baseCT = strings.TrimSpace(baseCT)
-				if _, ok := rb.Content[baseCT]; !ok {
-					allowed := make([]string, 0, len(rb.Content))
-					for k := range rb.Content {
-						allowed = append(allowed, k)
-					}
+				// Match structurally so "+json" types and parameters such as
+				// charset don't defeat the lookup.
+				_, mediaType, ok := lookupMediaType(rb.Content, ct)
+				if !ok {
+					baseCT := strings.TrimSpace(strings.Split(ct, ";")[0])
 					return validationError(c, logger, 415,
-						fmt.Sprintf("Unsupported media type: %s. Allowed: %s", baseCT, strings.Join(allowed, ", ")))
+						fmt.Sprintf("Unsupported media type: %s. Allowed: %s", baseCT, strings.Join(sortedContentTypes(rb.Content), ", ")))
 				}
 
 				// 2c. Validate body against schema (required fields, types, etc.)
-				mediaType := rb.Content[baseCT]
-				if mediaType.Schema != nil && mediaType.Schema.Value != nil {
-					if violations := validateBody(c.Body(), mediaType.Schema.Value); len(violations) > 0 {
+				// Only JSON bodies can be checked; a wildcard declaration may
+				// let other payloads through.
+				if isJSONMediaType(ct) && mediaType != nil && mediaType.Schema != nil && mediaType.Schema.Value != nil {
+					if opts.CoerceTypes {
+						coerceBody(payload, mediaType.Schema.Value)
+					}
+					if violations := validateBody(payload, mediaType.Schema.Value); len(violations) > 0 {
 						return bodyValidationError(c, logger, 400, violations)
 					}
 				}
@@ -102,13 +214,38 @@ func handle(c *fiber.Ctx, method, resource string, store *Store, dataFile string
 		}
 	}
 
-	// ── STEP 3: Required query / path parameters ───────────────────────
+	// ── STEP 3: Required query / path / header / cookie parameters ─────
 	if operation != nil {
 		for _, paramRef := range operation.Parameters {
 			if paramRef.Value == nil {
 				continue
 			}
 			p := paramRef.Value
+
+			// Fill missing query parameters from their declared example so
+			// later steps (templates, filtering) see a value.
+			if opts.UseParamExamples && p.In == "query" && c.Query(p.Name) == "" {
+				if ex, ok := paramExample(p); ok {
+					c.Request().URI().QueryArgs().Set(p.Name, ex)
+					logger.Info(ComponentValidator,
+						fmt.Sprintf("Query parameter \"%s\" is missing; using its example %q", p.Name, ex))
+				}
+			}
+
+			if opts.Validator == ValidatorKin {
+				continue
+			}
+			if p.In == "query" && isArrayParam(p) {
+				if violations := checkQueryArray(c, p); len(violations) > 0 {
+					return bodyValidationError(c, logger, 400, violations)
+				}
+			}
+			if p.In == "cookie" {
+				if violations := checkCookieParam(c, p); len(violations) > 0 {
+					return bodyValidationError(c, logger, 400, violations)
+				}
+			}
+
 			if !p.Required {
 				continue
 			}
@@ -120,6 +257,8 @@ func handle(c *fiber.Ctx, method, resource string, store *Store, dataFile string
 				val = c.Params(p.Name)
 			case "header":
 				val = c.Get(p.Name)
+			case "cookie":
+				val = c.Cookies(p.Name)
 			}
 			if val == "" {
 				return validationError(c, logger, 400,
@@ -128,79 +267,405 @@ func handle(c *fiber.Ctx, method, resource string, store *Store, dataFile string
 		}
 	}
 
+	// ── STEP 1–3 by kin-openapi (--validator kin) ──────────────────────
+	if opts.Validator == ValidatorKin {
+		if status, violations := kinValidateRequest(c, method, specPath, operation); status != 0 {
+			return bodyValidationError(c, logger, status, violations)
+		}
+	}
+
+	// ── STEP 3b: Undeclared query parameters (--strict-query) ──────────
+	if opts.StrictQuery && operation != nil {
+		if unknown := unknownQueryParams(c, specPath, operation, opts); len(unknown) > 0 {
+			violations := make([]string, len(unknown))
+			for i, name := range unknown {
+				violations[i] = fmt.Sprintf("Unknown query parameter \"%s\"", name)
+			}
+			return bodyValidationError(c, logger, 400, violations)
+		}
+	}
+
 	logger.Success(ComponentValidator, "Request passed all validation rules")
 
+	// ── Scenarios (--scenarios, X-Mock-Scenario) ───────────────────────
+	if name := c.Get(headerScenario); name != "" {
+		if sc, ok := opts.routeScenario(method, specPath, name); ok {
+			logger.Info(ComponentNegotiator, fmt.Sprintf("Using scenario %q", name))
+			logger.RespondWith(sc.Status)
+			return sc.send(c)
+		}
+		logger.Warning(ComponentNegotiator, fmt.Sprintf("No scenario %q for this route; responding normally", name))
+	}
+
+	// ── Forced status (?__status=500, --allow-status-override) ─────────
+	if forced := c.Query(queryForceStatus); forced != "" && opts.AllowStatusOverride {
+		status, _ := strconv.Atoi(forced)
+		if resp, ok := declaredResponse(operation, status); ok {
+			logger.Info(ComponentNegotiator, fmt.Sprintf("Status overridden to %d by %s", status, queryForceStatus))
+			logger.RespondWith(status)
+			if body, ok := responseExample(c, resp); ok {
+				body.Status = status
+				return body.send(c)
+			}
+			if status >= 400 {
+				return writeError(c, status, fmt.Sprintf("Status %d forced by %s", status, queryForceStatus))
+			}
+			return c.SendStatus(status)
+		}
+		logger.Warning(ComponentNegotiator,
+			fmt.Sprintf("%s=%s is not a status this operation declares; ignoring it", queryForceStatus, forced))
+	}
+
+	// ── Content negotiation (Accept) ───────────────────────────────────
+	if accept := c.Get(fiber.HeaderAccept); accept != "" {
+		_, resp := operationResponse(operation, opts.successStatus(method, specPath, defaultStatus(method)))
+		offered := offeredContentTypes(resp)
+		if _, ok := negotiate(accept, offered); !ok {
+			msg := fmt.Sprintf("None of the accepted media types can be served. Available: %s", strings.Join(offered, ", "))
+			return errorResponse(c, logger, fiber.StatusNotAcceptable, msg)
+		}
+	}
+
+	// ── Matched responses (x-mock-matchers) ────────────────────────────
+	if m, i, ok := matchRequest(c, operation, payload); ok {
+		logger.Info(ComponentNegotiator, fmt.Sprintf("Request matches %s[%d]", extMatchers, i))
+		logger.RespondWith(m.Status)
+		return m.send(c)
+	}
+
+	// ── Weighted statuses (x-mock-status-weights) ──────────────────────
+	// A rolled success status without an example is left to the steps
+	// below; errors always answer here.
+	if status, ok := rollStatus(operation, rng); ok {
+		resp, _ := declaredResponse(operation, status)
+		if body, ok := responseExample(c, resp); ok {
+			logger.Info(ComponentNegotiator, fmt.Sprintf("Rolled %d from %s", status, extStatusWeights))
+			logger.RespondWith(status)
+			body.Status = status
+			return body.send(c)
+		}
+		if status >= 400 {
+			logger.Info(ComponentNegotiator, fmt.Sprintf("Rolled %d from %s", status, extStatusWeights))
+			logger.RespondWith(status)
+			return writeError(c, status, fmt.Sprintf("Status %d picked by %s", status, extStatusWeights))
+		}
+		logger.Info(ComponentNegotiator, fmt.Sprintf("Rolled %d from %s; responding normally", status, extStatusWeights))
+	}
+
+	// ── Sequenced responses (x-mock-sequence) ──────────────────────────
+	if status, seq := mockSequence(operation); len(seq) > 0 {
+		n := store.NextCall(method + " " + c.Path())
+		if n >= len(seq) {
+			n = len(seq) - 1
+		}
+		logger.Info(ComponentNegotiator, fmt.Sprintf("Using sequence entry %d of %d", n+1, len(seq)))
+		logger.RespondWith(status)
+		return c.Status(status).JSON(seq[n])
+	}
+
+	// ── Templated responses (x-mock-template) ──────────────────────────
+	if status, contentType, tmpl := mockTemplate(operation); tmpl != nil {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, templateContext(c, operation, payload)); err != nil {
+			return errorResponse(c, logger, 500, fmt.Sprintf("Failed to render %s: %s", extTemplate, err))
+		}
+		logger.RespondWith(status)
+		c.Set(fiber.HeaderContentType, contentType)
+		return c.Status(status).Send(buf.Bytes())
+	}
+
+	// ── Spec responses (examples, Prefer: dynamic=true) ────────────────
+	resolved := resolveResponseBody(c, operation, opts.successStatus(method, specPath, defaultStatus(method)), store, resource, rng)
+	if preferences(c.Get(headerPrefer))["dynamic"] == "true" && resolved.Source != sourceGenerated {
+		if isMutating(method) {
+			logger.Info(ComponentNegotiator, "Prefer: dynamic=true only applies to reads; writing to the store")
+		} else {
+			logger.Warning(ComponentNegotiator, "No success response schema to generate from; responding normally")
+		}
+	}
+	switch resolved.Source {
+	case sourceGenerated:
+		c.Set(headerPreferenceApplied, "dynamic=true")
+		fallthrough
+	case sourceExamples, sourceExample, sourceSchema:
+		logger.Info(ComponentNegotiator, fmt.Sprintf("Responding with the %s from the spec", resolved.Source))
+		logger.RespondWith(resolved.Status)
+		return resolved.send(c)
+	}
+
 	// ── STEP 4: Mock response ──────────────────────────────────────────
-	store.mu.Lock()
-	defer store.mu.Unlock()
+	// Reads share the collection, plus any collections they embed or
+	// expand; writes to it are exclusive.
+	col := store.Collection(resource)
+	var rel relations
+	if isMutating(method) {
+		col.Lock()
+		defer col.Unlock()
+	} else {
+		rel = parseRelations(queryValues(c))
+		unlock := store.rlockCollections(append(rel.collections(), resource))
+		defer unlock()
+	}
 
-	if store.Data[resource] == nil {
-		store.Data[resource] = []map[string]any{}
+	list := col.Records
+	var id int
+	if route.ItemParam != "" {
+		id, _ = strconv.Atoi(c.Params(route.ItemParam))
 	}
 
-	list := store.Data[resource]
-	id, _ := strconv.Atoi(c.Params("id"))
+	// Nested paths such as /users/{id}/settings only see the records that
+	// point at their parent through its foreign key, e.g. "userId".
+	var fk string
+	var parentID int
+	if route.Parent != "" {
+		fk, parentID = foreignKey(route.Parent), toID(c.Params(route.ParentParam))
+	}
+	find := func(id int) (int, map[string]any) {
+		i, item := col.Find(id)
+		if item != nil && fk != "" && toID(item[fk]) != parentID {
+			return -1, nil
+		}
+		return i, item
+	}
 
 	switch method {
-	case fiber.MethodGet:
-		if id > 0 {
-			for _, item := range list {
-				if int(item["id"].(float64)) == id {
-					logger.RespondWith(200)
-					return c.JSON(item)
+	case fiber.MethodGet, fiber.MethodHead:
+		// HEAD runs the GET logic; fasthttp drops the body but keeps the
+		// status and headers, including Content-Length.
+		if route.ItemParam != "" {
+			if _, item := find(id); item != nil {
+				if !rel.empty() {
+					item = rel.resolve(store, resource, []map[string]any{item})[0]
 				}
+				status := opts.successStatus(method, specPath, 200)
+				logger.RespondWith(status)
+				if opts.Envelope == EnvelopeAll {
+					return c.Status(status).JSON(fiber.Map{"data": item})
+				}
+				return c.Status(status).JSON(item)
+			}
+			return errorResponse(c, logger, 404, notFoundMessage(resource, c.Params(route.ItemParam)))
+		}
+		query := c.Queries()
+		if opts.Pagination == PaginationCursor {
+			delete(query, queryCursor)
+		}
+		for _, name := range nonFilterParams(specPath, operation) {
+			delete(query, name)
+		}
+		filters, err := parseFilters(query)
+		if err != nil {
+			return validationError(c, logger, 400, err.Error())
+		}
+		if fk != "" {
+			filters = append(filters, recordFilter{field: fk, value: strconv.Itoa(parentID)})
+		}
+		list = filterRecords(list, filters)
+		total := len(list)
+
+		var nextCursor any
+		meta := fiber.Map{"total": total}
+		if opts.Pagination == PaginationCursor {
+			cursor, err := parseCursor(c, opts)
+			if err != nil {
+				return validationError(c, logger, 400, err.Error())
+			}
+			list, nextCursor = cursor.slice(list)
+			meta["limit"], meta["nextCursor"] = cursor.Limit, nextCursor
+		} else {
+			page, paginated, err := parsePage(c, opts)
+			if err != nil {
+				return validationError(c, logger, 400, err.Error())
+			}
+			if paginated {
+				list = page.slice(list)
+				c.Set(fiber.HeaderLink, page.links(c, total))
+				meta["page"], meta["limit"], meta["pages"] = page.Page, page.Limit, page.lastPage(total)
 			}
-			logger.RespondWith(404)
-			return fiber.ErrNotFound
 		}
+		if !rel.empty() {
+			list = rel.resolve(store, resource, list)
+		}
+
 		logger.Success(ComponentNegotiator, fmt.Sprintf("Found %d items. Responding with collection", len(list)))
-		logger.RespondWith(200)
-		return c.JSON(list)
+		status := opts.successStatus(method, specPath, 200)
+		logger.RespondWith(status)
+		c.Set(headerTotalCount, strconv.Itoa(total))
+		if wantsNDJSON(c, operation, status) {
+			return writeNDJSON(c, status, list)
+		}
+		if opts.Envelope == EnvelopeCollections || opts.Envelope == EnvelopeAll {
+			return c.Status(status).JSON(fiber.Map{"data": list, "meta": meta})
+		}
+		if opts.Pagination == PaginationCursor {
+			return c.Status(status).JSON(fiber.Map{"data": list, "nextCursor": nextCursor})
+		}
+		// HEAD needs the Content-Length, and --validate-responses the whole
+		// body, so both get the array in one piece.
+		if method == fiber.MethodHead || opts.ValidateResponses {
+			return c.Status(status).JSON(list)
+		}
+		return writeJSONArray(c, status, list, func() func() {
+			return store.rlockCollections(append(rel.collections(), resource))
+		})
 
 	case fiber.MethodPost:
-		body := make(map[string]any)
-		_ = c.BodyParser(&body)
-		body["id"] = len(list) + 1
-		store.Data[resource] = append(list, body)
-		saveStore(store, dataFile)
-		logger.RespondWith(201)
-		return c.Status(201).JSON(body)
-
-	case fiber.MethodPut, fiber.MethodPatch:
-		for i, item := range list {
-			if int(item["id"].(float64)) == id {
-				body := make(map[string]any)
-				_ = c.BodyParser(&body)
-				for k, v := range body {
-					item[k] = v
-				}
-				store.Data[resource][i] = item
-				saveStore(store, dataFile)
-				logger.RespondWith(200)
-				return c.JSON(item)
+		if echo, ok := mockEcho(operation); ok {
+			payload := payload
+			if echo.Wrap != "" {
+				payload = fiber.Map{echo.Wrap: payload}
+			}
+			logger.Info(ComponentNegotiator, "Echoing the request body")
+			logger.RespondWith(echo.Status)
+			return c.Status(echo.Status).JSON(payload)
+		}
+
+		// A client-supplied id is kept, unless --server-ids says ids are
+		// the server's to assign.
+		body := recordBody(payload)
+		if supplied, ok := body["id"]; ok {
+			if opts.ServerIDs {
+				return errorResponse(c, logger, 400, "id is server-generated")
+			}
+			newID := toID(supplied)
+			if newID <= 0 {
+				return errorResponse(c, logger, 400, "id must be a positive integer")
+			}
+			if _, existing := col.Find(newID); existing != nil {
+				return errorResponse(c, logger, fiber.StatusConflict, fmt.Sprintf("A %s with id %d already exists", singularize(resource), newID))
+			}
+			body["id"] = newID
+		} else {
+			body["id"] = col.NextID()
+		}
+		if fk != "" {
+			body[fk] = parentID
+		}
+		if err := applyComputed(operation, body); err != nil {
+			return errorResponse(c, logger, 500, fmt.Sprintf("Failed to render %s", err))
+		}
+		col.Append(body)
+		saveStore(store, opts.DataFile, resource)
+		status := opts.successStatus(method, specPath, 201)
+		logger.RespondWith(status)
+		c.Set(fiber.HeaderLocation, strings.TrimSuffix(c.Path(), "/")+"/"+fmt.Sprint(body["id"]))
+		// A response declared without content means the API answers a
+		// create with just the Location.
+		if resp, ok := declaredResponse(operation, status); ok && len(resp.Content) == 0 {
+			c.Status(status)
+			return nil
+		}
+		// The body is the new record, which lives at the Location.
+		c.Set(fiber.HeaderContentLocation, c.GetRespHeader(fiber.HeaderLocation))
+		return c.Status(status).JSON(body)
+
+	case fiber.MethodPut:
+		// PUT replaces the record: fields the body omits are dropped. Only
+		// the id and, on nested paths, the parent key survive; the URL's
+		// values win over the body's.
+		if i, item := find(id); item != nil {
+			body := recordBody(payload)
+			body["id"] = item["id"]
+			if fk != "" {
+				body[fk] = item[fk]
 			}
+			col.Records[i] = body
+			saveStore(store, opts.DataFile, resource)
+			status := opts.successStatus(method, specPath, 200)
+			logger.RespondWith(status)
+			c.Set(fiber.HeaderContentLocation, expandPath(specPath, c.AllParams()))
+			return c.Status(status).JSON(body)
 		}
-		logger.RespondWith(404)
-		return fiber.ErrNotFound
+		return errorResponse(c, logger, 404, notFoundMessage(resource, c.Params(route.ItemParam)))
+
+	case fiber.MethodPatch:
+		if _, item := find(id); item != nil {
+			body := recordBody(payload)
+			for k, v := range body {
+				item[k] = v
+			}
+			if recordID(item) != id {
+				col.Reindex()
+			}
+			saveStore(store, opts.DataFile, resource)
+			status := opts.successStatus(method, specPath, 200)
+			logger.RespondWith(status)
+			c.Set(fiber.HeaderContentLocation, expandPath(specPath, c.AllParams()))
+			return c.Status(status).JSON(item)
+		}
+		return errorResponse(c, logger, 404, notFoundMessage(resource, c.Params(route.ItemParam)))
 
 	case fiber.MethodDelete:
-		for i, item := range list {
-			if int(item["id"].(float64)) == id {
-				store.Data[resource] = append(list[:i], list[i+1:]...)
-				saveStore(store, dataFile)
-				logger.RespondWith(204)
-				return c.SendStatus(204)
+		if i, item := find(id); item != nil {
+			col.Remove(i)
+			saveStore(store, opts.DataFile, resource)
+			status := opts.successStatus(method, specPath, 204)
+
+			// Prefer: return=representation asks for the removed record,
+			// return=minimal for no body, whatever the configured status.
+			prefer := preferences(c.Get(headerPrefer))["return"]
+			if prefer == "representation" || prefer == "minimal" {
+				c.Set(headerPreferenceApplied, "return="+prefer)
+			}
+			if prefer == "representation" && status == 204 {
+				status = 200
 			}
+			logger.RespondWith(status)
+			if status == 204 || prefer == "minimal" {
+				c.Status(status)
+				return nil
+			}
+			return c.Status(status).JSON(item)
 		}
-		logger.RespondWith(404)
-		return fiber.ErrNotFound
+		return errorResponse(c, logger, 404, notFoundMessage(resource, c.Params(route.ItemParam)))
 	}
 
-	return fiber.ErrNotImplemented
+	return errorResponse(c, logger, fiber.StatusNotImplemented,
+		fmt.Sprintf("The mock has no behaviour for %s; answer it with a scenario, %s, %s or %s", method, extMatchers, extSequence, extTemplate))
+}
+
+// defaultStatus is the success status a method answers with unless
+// --status or a --<method>-status flag says otherwise.
+func defaultStatus(method string) int {
+	switch method {
+	case fiber.MethodPost:
+		return 201
+	case fiber.MethodDelete:
+		return 204
+	}
+	return 200
 }
 
+// headerTotalCount carries the size of a collection.
+const headerTotalCount = "X-Total-Count"
+
+// RFC 7240 preference headers.
+const (
+	headerPrefer            = "Prefer"
+	headerPreferenceApplied = "Preference-Applied"
+)
+
+// headerSeed seeds the randomness of a single request.
+const headerSeed = "X-Mock-Seed"
+
+// queryForceStatus picks a declared response status under
+// --allow-status-override.
+const queryForceStatus = "__status"
+
 // ─── Helpers ────────────────────────────────────────────────────────────────
 
+// requestID returns the id used to correlate a request's log lines. The
+// caller's X-Request-Id is reused when supplied so logs line up across
+// services; otherwise a fresh one is minted. It is echoed on the response.
+func requestID(c *fiber.Ctx) string {
+	id := c.Get(fiber.HeaderXRequestID)
+	if id == "" {
+		id = utils.UUIDv4()
+	}
+	c.Set(fiber.HeaderXRequestID, id)
+	return id
+}
+
 // resolveSecurityRequirements returns the effective security requirements for
 // an operation.  Per-operation security wins; if absent we fall back to the
 // top-level (global) security definition.
@@ -285,32 +750,62 @@ func isAuthenticated(c *fiber.Ctx, reqs openapi3.SecurityRequirements) bool {
 	return false
 }
 
-// validateBody checks the JSON body against the schema's required fields and
+// validateBody checks the parsed JSON body against the schema's required fields and
 // basic type constraints.  It handles allOf / oneOf / anyOf compositions by
 // flattening required fields and properties from all sub-schemas.
 // Returns a slice of all validation error messages (empty = valid).
-func validateBody(raw []byte, schema *openapi3.Schema) []string {
-	var body map[string]any
-	if err := json.Unmarshal(raw, &body); err != nil {
-		return []string{fmt.Sprintf("Invalid JSON body: %s", err.Error())}
+func validateBody(payload any, schema *openapi3.Schema) []string {
+	body, ok := payload.(map[string]any)
+	if !ok {
+		return []string{"request.body Request body must be object"}
 	}
 
-	// Collect all required fields and property schemas by walking the schema
-	// tree (allOf, oneOf, anyOf and the schema itself).
-	required, props := collectSchemaConstraints(schema)
+	// Required fields and property schemas, flattened from the schema tree
+	// (allOf, oneOf, anyOf and the schema itself) once per schema.
+	sc := constraintsFor(schema)
 
 	var violations []string
 
+	if err := checkPropertyCount("Request body", body, schema); err != nil {
+		violations = append(violations, "request.body "+err.Error())
+	}
+
 	// Check required fields — collect ALL missing, don't stop at first
-	for _, field := range required {
+	for _, field := range sc.required {
 		if _, ok := body[field]; !ok {
 			violations = append(violations,
 				fmt.Sprintf("request.body Request body must have required property '%s'", field))
 		}
 	}
 
+	// Properties required only alongside another (dependentRequired)
+	for _, trigger := range sc.triggers {
+		if _, ok := body[trigger]; !ok {
+			continue
+		}
+		for _, field := range sc.dependents[trigger] {
+			if _, ok := body[field]; !ok {
+				violations = append(violations,
+					fmt.Sprintf("request.body Request body must have property '%s' when '%s' is present", field, trigger))
+			}
+		}
+	}
+
+	// if/then/else: a body satisfying if must satisfy then, any other body
+	// must satisfy else
+	if sc.cond != nil {
+		branch := sc.cond.Else
+		if len(validateBody(body, sc.cond.If)) == 0 {
+			branch = sc.cond.Then
+		}
+		if branch != nil {
+			violations = append(violations, validateBody(body, branch)...)
+		}
+	}
+
 	// Check property types for supplied values
-	for name, prop := range props {
+	for _, name := range sc.names {
+		prop := sc.props[name]
 		val, exists := body[name]
 		if !exists {
 			continue
@@ -326,6 +821,70 @@ func validateBody(raw []byte, schema *openapi3.Schema) []string {
 	return violations
 }
 
+// coerceBody converts string values in a JSON object body to the integer,
+// number or boolean their property schema declares, in place, so "30" is
+// validated and stored as 30. Strings that don't parse are left for
+// validateBody to reject.
+func coerceBody(payload any, schema *openapi3.Schema) {
+	body, ok := payload.(map[string]any)
+	if !ok {
+		return
+	}
+	sc := constraintsFor(schema)
+	for _, name := range sc.names {
+		if s, ok := body[name].(string); ok && sc.props[name] != nil {
+			body[name] = coerceString(s, sc.props[name])
+		}
+	}
+}
+
+// schemaConstraints is the flattened form of a request schema that
+// validateBody checks against.
+type schemaConstraints struct {
+	required []string
+	props    map[string]*openapi3.Schema
+	names    []string // keys of props, sorted
+
+	// dependents maps a property to the ones required when it is present
+	// (dependentRequired); triggers lists its keys, sorted.
+	dependents map[string][]string
+	triggers   []string
+
+	// cond holds an OpenAPI 3.1 if/then/else, nil when the schema has none.
+	cond *conditional
+}
+
+// conditional is a parsed if/then/else. Then or Else may be nil.
+type conditional struct {
+	If, Then, Else *openapi3.Schema
+}
+
+// constraintCache memoizes schemaConstraints by schema pointer. Schemas never
+// change after the spec is loaded.
+var constraintCache sync.Map
+
+// constraintsFor returns the cached constraints for schema, computing them on
+// first use.
+func constraintsFor(schema *openapi3.Schema) *schemaConstraints {
+	if sc, ok := constraintCache.Load(schema); ok {
+		return sc.(*schemaConstraints)
+	}
+	required, props := collectSchemaConstraints(schema)
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	dependents := dependentRequired(schema)
+	triggers := make([]string, 0, len(dependents))
+	for name := range dependents {
+		triggers = append(triggers, name)
+	}
+	sort.Strings(triggers)
+	sc, _ := constraintCache.LoadOrStore(schema, &schemaConstraints{required, props, names, dependents, triggers, conditionalOf(schema)})
+	return sc.(*schemaConstraints)
+}
+
 // collectSchemaConstraints walks a schema (including allOf, oneOf, anyOf) and
 // returns the union of all required field names and a merged property map.
 func collectSchemaConstraints(schema *openapi3.Schema) ([]string, map[string]*openapi3.Schema) {
@@ -394,6 +953,10 @@ func checkType(name string, val any, prop *openapi3.Schema) error {
 		return nil
 	}
 
+	if want, ok := prop.Extensions[keywordConst]; ok && !reflect.DeepEqual(want, val) {
+		return fmt.Errorf("Property \"%s\" must be equal to %v", name, want)
+	}
+
 	switch prop.Type {
 	case "string":
 		s, ok := val.(string)
@@ -434,46 +997,301 @@ func checkType(name string, val any, prop *openapi3.Schema) error {
 		if prop.MinItems > 0 && uint64(len(arr)) < prop.MinItems {
 			return fmt.Errorf("Property \"%s\" must have at least %d items", name, prop.MinItems)
 		}
+	case "object":
+		if obj, ok := val.(map[string]any); ok {
+			return checkPropertyCount(fmt.Sprintf("Property \"%s\"", name), obj, prop)
+		}
 	}
 	return nil
 }
 
-// needsRequestBody returns true for methods that can carry a body.
-func needsRequestBody(method string) bool {
+// checkPropertyCount enforces minProperties and maxProperties on an object.
+// subject names it in the message, e.g. "Request body".
+func checkPropertyCount(subject string, obj map[string]any, schema *openapi3.Schema) error {
+	if schema.MinProps > 0 && uint64(len(obj)) < schema.MinProps {
+		return fmt.Errorf("%s must have at least %d properties", subject, schema.MinProps)
+	}
+	if schema.MaxProps != nil && uint64(len(obj)) > *schema.MaxProps {
+		return fmt.Errorf("%s must have at most %d properties", subject, *schema.MaxProps)
+	}
+	return nil
+}
+
+// recordID reads a record's id. Records loaded from disk carry float64 ids
+// while ones created in this process carry ints.
+func recordID(item map[string]any) int {
+	return toID(item["id"])
+}
+
+// toID reads an id or foreign key value, which may be a number or a numeric
+// string. Anything else yields 0.
+func toID(v any) int {
+	switch v := v.(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+	return 0
+}
+
+// paramExample returns a parameter's example as a query-string value,
+// looking at the parameter's example, then its first named example, then its
+// schema's example.
+func paramExample(p *openapi3.Parameter) (string, bool) {
+	var ex any
+	switch {
+	case p.Example != nil:
+		ex = p.Example
+	case len(p.Examples) > 0:
+		names := make([]string, 0, len(p.Examples))
+		for name := range p.Examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if ref := p.Examples[names[0]]; ref != nil && ref.Value != nil {
+			ex = ref.Value.Value
+		}
+	case p.Schema != nil && p.Schema.Value != nil:
+		ex = p.Schema.Value.Example
+	}
+	if ex == nil {
+		return "", false
+	}
+	if items, ok := ex.([]any); ok {
+		parts := make([]string, len(items))
+		for i, item := range items {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, ","), true
+	}
+	return fmt.Sprint(ex), true
+}
+
+// expandPath fills a spec path's {param} placeholders from the matched
+// route parameters, giving the canonical URL of the resource.
+func expandPath(specPath string, params map[string]string) string {
+	for name, value := range params {
+		specPath = strings.ReplaceAll(specPath, "{"+name+"}", url.PathEscape(value))
+	}
+	return specPath
+}
+
+// preferences parses a Prefer header such as
+// "return=representation, respond-async" into lower-cased name/value pairs.
+// Preference parameters after ';' are ignored.
+func preferences(header string) map[string]string {
+	prefs := map[string]string{}
+	for _, part := range strings.Split(header, ",") {
+		part, _, _ = strings.Cut(part, ";")
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			prefs[name] = strings.ToLower(strings.Trim(strings.TrimSpace(value), `"`))
+		}
+	}
+	return prefs
+}
+
+// queryValues returns a lookup of every value given for a query key, so
+// repeated keys such as ?_embed=a&_embed=b are all seen.
+func queryValues(c *fiber.Ctx) func(key string) []string {
+	args := c.Request().URI().QueryArgs()
+	return func(key string) []string {
+		var values []string
+		for _, v := range args.PeekMulti(key) {
+			values = append(values, string(v))
+		}
+		return values
+	}
+}
+
+// isMutating reports whether method changes the store.
+func isMutating(method string) bool {
 	switch method {
-	case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch:
+	case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
 		return true
 	}
 	return false
 }
 
-// operationForPathMethod returns the OpenAPI Operation for a given path+method.
-func operationForPathMethod(path, method string) *openapi3.Operation {
-	if openapiDoc == nil {
+// recordBody returns the parsed request body as a record to store, or an
+// empty one when the body is missing or isn't a JSON object.
+func recordBody(payload any) map[string]any {
+	if body, ok := payload.(map[string]any); ok {
+		return body
+	}
+	return map[string]any{}
+}
+
+// isEmptyBody reports whether a request carries no usable body: nothing,
+// only whitespace, or a JSON null.
+func isEmptyBody(raw []byte, contentType string) bool {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 {
+		return true
+	}
+	return string(trimmed) == "null" && (contentType == "" || isJSONMediaType(contentType))
+}
+
+// unknownQueryParams lists, sorted, the query keys a request sends that the
+// operation and its path item don't declare. Keys starting with "_" belong
+// to the mock itself (_page, _limit, _embed, __status, ...) and are never
+// reported, nor are ?cursor= under --pagination cursor and API keys sent in
+// the query.
+func unknownQueryParams(c *fiber.Ctx, specPath string, op *openapi3.Operation, opts *Options) []string {
+	declared := map[string]bool{}
+	params := op.Parameters
+	if item := openapiDoc.Paths[specPath]; item != nil {
+		params = append(params[:len(params):len(params)], item.Parameters...)
+	}
+	for _, ref := range params {
+		if ref.Value != nil && ref.Value.In == "query" {
+			declared[ref.Value.Name] = true
+		}
+	}
+	if opts.Pagination == PaginationCursor {
+		declared[queryCursor] = true
+	}
+	for _, name := range credentialQueryParams(op) {
+		declared[name] = true
+	}
+
+	var unknown []string
+	for key := range c.Queries() {
+		if !declared[key] && !strings.HasPrefix(key, "_") {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// credentialQueryParams returns the apiKey query parameters op's security
+// requirements accept.
+func credentialQueryParams(op *openapi3.Operation) []string {
+	if openapiDoc.Components == nil {
 		return nil
 	}
-	if item := openapiDoc.Paths.Find(path); item != nil {
-		switch method {
-		case fiber.MethodGet:
-			return item.Get
-		case fiber.MethodPost:
-			return item.Post
-		case fiber.MethodPut:
-			return item.Put
-		case fiber.MethodPatch:
-			return item.Patch
-		case fiber.MethodDelete:
-			return item.Delete
+	var names []string
+	for _, req := range resolveSecurityRequirements(op) {
+		for name := range req {
+			if ref := openapiDoc.Components.SecuritySchemes[name]; ref != nil && ref.Value != nil && ref.Value.In == "query" {
+				names = append(names, ref.Value.Name)
+			}
 		}
 	}
-	return nil
+	return names
+}
+
+// emptyBodyReason says why isEmptyBody found a body empty, for error
+// messages.
+func emptyBodyReason(raw []byte, contentType string) string {
+	switch {
+	case len(raw) == 0 && contentType == "":
+		return "no body was sent"
+	case len(raw) == 0:
+		return fmt.Sprintf("the body is empty although Content-Type is %s", contentType)
+	case len(bytes.TrimSpace(raw)) == 0:
+		return "the body is only whitespace"
+	}
+	return "the body is JSON null"
 }
 
-// saveStore persists the store to disk.
-func saveStore(store *Store, dataFile string) {
+// needsRequestBody returns true for methods that can carry a body.
+func needsRequestBody(method string) bool {
+	switch method {
+	case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch:
+		return true
+	}
+	return false
+}
+
+// saveStore persists the store to disk. In directory mode only the changed
+// resource's file is rewritten.
+func saveStore(store *Store, dataFile, resource string) {
+	if store.dir != "" {
+		store.SaveResource(resource)
+		return
+	}
 	if dataFile == "" {
-		store.Save("data.json")
+		store.Save("data.json", resource)
 	} else {
-		store.Save(dataFile)
+		store.Save(dataFile, resource)
+	}
+}
+
+// Schema keywords kin-openapi doesn't model. They land in the schema's
+// Extensions, and loadSpec allows them as sibling fields.
+const (
+	keywordDependentRequired = "dependentRequired"
+	keywordDependencies      = "dependencies" // the OpenAPI 3.0 / draft 4 spelling
+
+	// OpenAPI 3.1 only; see conditionalOf.
+	keywordIf    = "if"
+	keywordThen  = "then"
+	keywordElse  = "else"
+	keywordConst = "const"
+)
+
+// dependentRequired reads a schema's dependentRequired, or the older
+// dependencies keyword, including those of its allOf branches. Entries of
+// dependencies that hold a schema rather than a list of names are ignored.
+func dependentRequired(schema *openapi3.Schema) map[string][]string {
+	deps := map[string][]string{}
+	if schema == nil {
+		return deps
+	}
+	for _, keyword := range []string{keywordDependencies, keywordDependentRequired} {
+		raw, _ := schema.Extensions[keyword].(map[string]any)
+		for trigger, v := range raw {
+			names, ok := v.([]any)
+			if !ok {
+				continue
+			}
+			for _, n := range names {
+				if s, ok := n.(string); ok {
+					deps[trigger] = append(deps[trigger], s)
+				}
+			}
+		}
+	}
+	for _, sub := range schema.AllOf {
+		for trigger, names := range dependentRequired(sub.Value) {
+			deps[trigger] = append(deps[trigger], names...)
+		}
+	}
+	return deps
+}
+
+// conditionalOf parses a schema's if/then/else. kin-openapi leaves these
+// as raw maps in Extensions, so each is decoded into a Schema of its own;
+// $refs inside them are not resolved. A schema without if, or with
+// neither then nor else, has no conditional.
+func conditionalOf(schema *openapi3.Schema) *conditional {
+	parse := func(keyword string) *openapi3.Schema {
+		raw, ok := schema.Extensions[keyword].(map[string]any)
+		if !ok {
+			return nil
+		}
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return nil
+		}
+		var s openapi3.Schema
+		if err := json.Unmarshal(b, &s); err != nil {
+			return nil
+		}
+		return &s
+	}
+	if schema == nil {
+		return nil
+	}
+	cond := &conditional{If: parse(keywordIf), Then: parse(keywordThen), Else: parse(keywordElse)}
+	if cond.If == nil || (cond.Then == nil && cond.Else == nil) {
+		return nil
 	}
+	return cond
 }
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/getkin/kin-openapi/openapi3"
+	gorillamux "github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// testSpec is a users API with full CRUD on /users and /users/{id}.
+const testSpec = `openapi: 3.0.3
+info: {title: test, version: "1"}
+paths:
+  /users:
+    get:
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema: {type: array, items: {$ref: "#/components/schemas/User"}}
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema: {$ref: "#/components/schemas/User"}
+      responses:
+        "201":
+          description: created
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/User"}
+  /users/{id}:
+    parameters:
+      - {name: id, in: path, required: true, schema: {type: integer}}
+    get:
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/User"}
+    put:
+      requestBody:
+        content:
+          application/json:
+            schema: {$ref: "#/components/schemas/User"}
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/User"}
+    patch:
+      requestBody:
+        content:
+          application/json:
+            schema: {$ref: "#/components/schemas/User"}
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/User"}
+    delete:
+      responses:
+        "204": {description: deleted}
+components:
+  schemas:
+    User:
+      type: object
+      properties:
+        id: {type: integer}
+        name: {type: string}
+        email: {type: string}
+`
+
+// newTestApp starts the mock the way startServer does, from spec and data
+// written to a temporary directory, with request logging turned off.
+func newTestApp(t testing.TB, spec, data string, opts *Options) *fiber.App {
+	t.Helper()
+	dir := t.TempDir()
+	specFile := filepath.Join(dir, "api.yaml")
+	if err := os.WriteFile(specFile, []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if opts == nil {
+		opts = &Options{}
+	}
+	opts.DataFile = filepath.Join(dir, "data.json")
+	if data != "" {
+		if err := os.WriteFile(opts.DataFile, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	level := logLevel
+	logLevel = LevelSilent
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() {
+		logLevel = level
+		log.SetOutput(os.Stderr)
+	})
+
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromFile(specFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		t.Fatal(err)
+	}
+	openapiDoc = doc
+	r, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	openapiRouter = r
+
+	store := NewStore(opts.DataFile)
+	t.Cleanup(func() { _ = store.Flush() })
+	return NewApp(doc, store, opts)
+}
+
+// send makes one request against app. headers alternate names and values.
+func send(t testing.TB, app *fiber.App, method, target, body string, headers ...string) (*http.Response, string) {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	if body != "" {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+// decode unmarshals a JSON response body.
+func decode[T any](t testing.TB, body string) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		t.Fatalf("invalid JSON %q: %v", body, err)
+	}
+	return v
+}
+
+// BenchmarkValidateBody validates a body against an allOf schema with the
+// flattened constraints cached, against recomputing them on every call as
+// validateBody did before constraintsFor.
+func BenchmarkValidateBody(b *testing.B) {
+	prop := func(typ string) *openapi3.SchemaRef {
+		return openapi3.NewSchemaRef("", &openapi3.Schema{Type: typ})
+	}
+	schema := &openapi3.Schema{
+		Type: openapi3.TypeObject,
+		AllOf: openapi3.SchemaRefs{
+			openapi3.NewSchemaRef("", &openapi3.Schema{
+				Required:   []string{"id", "name"},
+				Properties: openapi3.Schemas{"id": prop(openapi3.TypeInteger), "name": prop(openapi3.TypeString)},
+			}),
+			openapi3.NewSchemaRef("", &openapi3.Schema{
+				Properties: openapi3.Schemas{"email": prop(openapi3.TypeString), "age": prop(openapi3.TypeInteger)},
+			}),
+		},
+		OneOf: openapi3.SchemaRefs{
+			openapi3.NewSchemaRef("", &openapi3.Schema{Properties: openapi3.Schemas{"admin": prop(openapi3.TypeBoolean)}}),
+			openapi3.NewSchemaRef("", &openapi3.Schema{Properties: openapi3.Schemas{"team": prop(openapi3.TypeString)}}),
+		},
+	}
+	body := map[string]any{"id": float64(1), "name": "Ann", "email": "ann@example.com", "age": float64(30), "admin": true}
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if v := validateBody(body, schema); len(v) > 0 {
+				b.Fatal(v)
+			}
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			constraintCache.Delete(schema)
+			if v := validateBody(body, schema); len(v) > 0 {
+				b.Fatal(v)
+			}
+		}
+	})
+}
+
+func TestEmptyOptionalBody(t *testing.T) {
+	bodies := []struct {
+		name, body, reason string
+	}{
+		{"empty", "", "the body is empty although Content-Type is application/json"},
+		{"whitespace", " \n\t ", "the body is only whitespace"},
+		{"null", "null", "the body is JSON null"},
+	}
+	for _, reject := range []bool{false, true} {
+		app := newTestApp(t, testSpec, "", &Options{RejectEmptyBody: reject})
+		for _, tt := range bodies {
+			resp, body := send(t, app, "POST", "/users", tt.body, fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			if reject {
+				if resp.StatusCode != 400 || !strings.Contains(body, "Request body is empty: "+tt.reason) {
+					t.Errorf("%s body with --reject-empty-body: got %d %s", tt.name, resp.StatusCode, body)
+				}
+				continue
+			}
+			if resp.StatusCode != 201 {
+				t.Errorf("%s body: got %d %s", tt.name, resp.StatusCode, body)
+				continue
+			}
+			if record := decode[map[string]any](t, body); len(record) != 1 || record["id"] == nil {
+				t.Errorf("%s body: stored %s, want a record with only an id", tt.name, body)
+			}
+		}
+	}
+}
+
+func TestInvalidJSONBody(t *testing.T) {
+	// /notes declares no body schema, so only the parse can catch these.
+	spec := strings.Replace(testSpec, "components:", `  /notes:
+    post:
+      requestBody:
+        content:
+          application/json: {}
+      responses:
+        "201": {description: created}
+components:`, 1)
+	app := newTestApp(t, spec, "", nil)
+
+	tests := []struct {
+		body, message string
+	}{
+		{`{"name":"Ann"`, "Invalid JSON body: unexpected end of JSON input"},
+		{`{"name":`, "Invalid JSON body: unexpected end of JSON input"},
+		{`{"name" "Ann"}`, "Invalid JSON body: invalid character '\"' after object key"},
+		{`{name: "Ann"}`, "Invalid JSON body: invalid character 'n' looking for beginning of object key string"},
+	}
+	for _, path := range []string{"/users", "/notes"} {
+		for _, tt := range tests {
+			resp, body := send(t, app, "POST", path, tt.body)
+			if resp.StatusCode != 400 {
+				t.Errorf("POST %s %s: got %d %s", path, tt.body, resp.StatusCode, body)
+				continue
+			}
+			if got := decode[map[string]any](t, body)["message"]; got != tt.message {
+				t.Errorf("POST %s %s: message %q, want %q", path, tt.body, got, tt.message)
+			}
+		}
+	}
+}
+
+func TestPutReplacesAndPatchMerges(t *testing.T) {
+	app := newTestApp(t, testSpec, `{"users": [{"id": 1, "name": "Ann", "email": "ann@example.com"}]}`, nil)
+
+	resp, body := send(t, app, "PUT", "/users/1", `{"name":"Anne"}`)
+	if resp.StatusCode != 200 {
+		t.Fatalf("PUT: got %d %s", resp.StatusCode, body)
+	}
+	want := map[string]any{"id": float64(1), "name": "Anne"}
+	if got := decode[map[string]any](t, body); !reflect.DeepEqual(got, want) {
+		t.Errorf("PUT answered %v, want %v", got, want)
+	}
+	_, body = send(t, app, "GET", "/users/1", "")
+	if got := decode[map[string]any](t, body); !reflect.DeepEqual(got, want) {
+		t.Errorf("after PUT, stored %v, want %v", got, want)
+	}
+
+	send(t, app, "PATCH", "/users/1", `{"email":"anne@example.com"}`)
+	_, body = send(t, app, "GET", "/users/1", "")
+	want = map[string]any{"id": float64(1), "name": "Anne", "email": "anne@example.com"}
+	if got := decode[map[string]any](t, body); !reflect.DeepEqual(got, want) {
+		t.Errorf("after PATCH, stored %v, want %v", got, want)
+	}
+}
+
+func TestContentLocation(t *testing.T) {
+	app := newTestApp(t, testSpec, `{"users": [{"id": 1, "name": "Ann"}]}`, nil)
+
+	tests := []struct {
+		method, path, body, want string
+	}{
+		{"POST", "/users", `{"name":"Bob"}`, "/users/2"},
+		{"POST", "/users/", `{"name":"Cy"}`, "/users/3"},
+		{"PUT", "/users/1", `{"name":"Anne"}`, "/users/1"},
+		{"PATCH", "/users/1", `{"name":"Annie"}`, "/users/1"},
+	}
+	for _, tt := range tests {
+		resp, body := send(t, app, tt.method, tt.path, tt.body)
+		if resp.StatusCode >= 300 {
+			t.Errorf("%s %s: got %d %s", tt.method, tt.path, resp.StatusCode, body)
+			continue
+		}
+		if got := resp.Header.Get(fiber.HeaderContentLocation); got != tt.want {
+			t.Errorf("%s %s: Content-Location = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRequiredBodyEmptyObjectEmptyAndMissing(t *testing.T) {
+	spec := strings.Replace(testSpec, "components:", `  /accounts:
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [name, email]
+              properties:
+                name: {type: string}
+                email: {type: string}
+      responses:
+        "201": {description: created, content: {application/json: {schema: {type: object}}}}
+components:`, 1)
+	app := newTestApp(t, spec, "", nil)
+
+	tests := []struct {
+		name, body string
+		headers    []string
+		message    string
+	}{
+		{"empty object", "{}", nil,
+			"request.body Request body must have required property 'name'; request.body Request body must have required property 'email'"},
+		{"empty", "", []string{fiber.HeaderContentType, fiber.MIMEApplicationJSON},
+			"Body parameter is required, but the body is empty although Content-Type is application/json"},
+		{"missing", "", nil,
+			"Body parameter is required, but no body was sent"},
+	}
+	for _, tt := range tests {
+		resp, body := send(t, app, "POST", "/accounts", tt.body, tt.headers...)
+		if resp.StatusCode != 400 {
+			t.Errorf("%s body: got %d %s", tt.name, resp.StatusCode, body)
+			continue
+		}
+		if got := decode[map[string]any](t, body)["message"]; got != tt.message {
+			t.Errorf("%s body: message %q, want %q", tt.name, got, tt.message)
+		}
+	}
+}
+
+func TestPropertyCountLimits(t *testing.T) {
+	two, three := uint64(2), uint64(3)
+	schema := &openapi3.Schema{
+		Type:     openapi3.TypeObject,
+		MinProps: 2,
+		MaxProps: &three,
+		Properties: openapi3.Schemas{
+			"tags": openapi3.NewSchemaRef("", &openapi3.Schema{Type: openapi3.TypeObject, MinProps: 1, MaxProps: &two}),
+		},
+	}
+	tests := []struct {
+		name string
+		body map[string]any
+		want []string
+	}{
+		{"at the minimum", map[string]any{"a": 1.0, "b": 2.0}, nil},
+		{"at the maximum", map[string]any{"a": 1.0, "b": 2.0, "c": 3.0}, nil},
+		{"under the minimum", map[string]any{"a": 1.0},
+			[]string{"request.body Request body must have at least 2 properties"}},
+		{"over the maximum", map[string]any{"a": 1.0, "b": 2.0, "c": 3.0, "d": 4.0},
+			[]string{"request.body Request body must have at most 3 properties"}},
+		{"nested under the minimum", map[string]any{"a": 1.0, "tags": map[string]any{}},
+			[]string{`request.body Property "tags" must have at least 1 properties`}},
+		{"nested over the maximum", map[string]any{"a": 1.0, "tags": map[string]any{"x": 1.0, "y": 2.0, "z": 3.0}},
+			[]string{`request.body Property "tags" must have at most 2 properties`}},
+	}
+	for _, tt := range tests {
+		if got := validateBody(tt.body, schema); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPostClientSuppliedIDs(t *testing.T) {
+	app := newTestApp(t, testSpec, `{"users": [{"id": 1, "name": "Ann"}]}`, nil)
+
+	resp, body := send(t, app, "POST", "/users", `{"id":5,"name":"Bob"}`)
+	if resp.StatusCode != 201 || decode[map[string]any](t, body)["id"] != float64(5) {
+		t.Fatalf("POST with a free id: got %d %s, want 201 keeping id 5", resp.StatusCode, body)
+	}
+	if resp, body := send(t, app, "POST", "/users", `{"id":1,"name":"Cy"}`); resp.StatusCode != 409 {
+		t.Errorf("POST with a taken id: got %d %s, want 409", resp.StatusCode, body)
+	}
+
+	app = newTestApp(t, testSpec, "", &Options{ServerIDs: true})
+	if resp, body := send(t, app, "POST", "/users", `{"id":5,"name":"Bob"}`); resp.StatusCode != 400 {
+		t.Errorf("POST with an id under --server-ids: got %d %s, want 400", resp.StatusCode, body)
+	}
+}
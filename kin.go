@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+// Request validation engines selectable with --validator.
+const (
+	ValidatorBuiltin = "builtin" // the mock's own STEP 1–3 checks
+	ValidatorKin     = "kin"     // kin-openapi's openapi3filter.ValidateRequest
+)
+
+// routerDoc is the spec as openapiRouter sees it: every servers entry is
+// dropped, because the mock serves each path at its root whatever host or
+// base path the spec lists.
+func routerDoc(doc *openapi3.T) *openapi3.T {
+	stripped := *doc
+	stripped.Servers = nil
+	stripped.Paths = make(openapi3.Paths, len(doc.Paths))
+	for path, item := range doc.Paths {
+		item := *item
+		item.Servers = nil
+		stripped.Paths[path] = &item
+	}
+	return &stripped
+}
+
+// kinRoute converts the request for kin-openapi and resolves its route
+// through openapiRouter. Requests fiber matches but gorillamux doesn't, such
+// as HEAD or a path in another letter case, keep the route fiber found.
+func kinRoute(c *fiber.Ctx, method, specPath string, op *openapi3.Operation) (*http.Request, *routers.Route, map[string]string, error) {
+	req := new(http.Request)
+	if err := fasthttpadaptor.ConvertRequest(c.Context(), req, true); err != nil {
+		return nil, nil, nil, err
+	}
+	// --use-param-examples may have filled in query parameters.
+	req.URL.RawQuery = string(c.Request().URI().QueryArgs().QueryString())
+
+	route, params, err := openapiRouter.FindRoute(req)
+	if err == nil {
+		return req, route, params, nil
+	}
+	route = &routers.Route{
+		Spec:      openapiDoc,
+		Path:      specPath,
+		PathItem:  openapiDoc.Paths[specPath],
+		Method:    operationMethod(method),
+		Operation: op,
+	}
+	return req, route, c.AllParams(), nil
+}
+
+// kinValidateRequest checks the request with openapi3filter.ValidateRequest
+// in place of the built-in checks (--validator kin). Credentials are judged
+// the way the built-in security check judges them. It returns the status to
+// answer with and every violation, worded like the built-in ones, or 0 when
+// the request is valid.
+func kinValidateRequest(c *fiber.Ctx, method, specPath string, op *openapi3.Operation) (int, []string) {
+	req, route, params, err := kinRoute(c, method, specPath, op)
+	if err != nil {
+		return fiber.StatusBadRequest, []string{err.Error()}
+	}
+	if route.Operation == nil {
+		return 0, nil
+	}
+
+	options := &openapi3filter.Options{
+		MultiError:          true,
+		SkipSettingDefaults: true,
+		AuthenticationFunc: func(_ context.Context, ai *openapi3filter.AuthenticationInput) error {
+			if !isAuthenticated(c, openapi3.SecurityRequirements{{ai.SecuritySchemeName: ai.Scopes}}) {
+				return errors.New("Invalid security scheme used")
+			}
+			return nil
+		},
+	}
+	options.WithCustomSchemaErrorFunc(kinSchemaMessage)
+	input := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: params,
+		Route:      route,
+		Options:    options,
+	}
+	err = openapi3filter.ValidateRequest(c.Context(), input)
+	if err == nil {
+		return 0, nil
+	}
+	status, violations := fiber.StatusBadRequest, []string{}
+	for _, err := range flattenErrors(err) {
+		var secErr *openapi3filter.SecurityRequirementsError
+		var reqErr *openapi3filter.RequestError
+		switch {
+		case errors.As(err, &secErr):
+			// Like the built-in check, missing credentials trump the rest.
+			return fiber.StatusUnauthorized, []string{"Invalid security scheme used"}
+		case errors.As(err, &reqErr) && reqErr.RequestBody != nil:
+			if strings.HasPrefix(reqErr.Reason, "header Content-Type") {
+				status = fiber.StatusUnsupportedMediaType
+				violations = append(violations, fmt.Sprintf("Unsupported media type: %s. Allowed: %s",
+					strings.TrimSpace(strings.Split(c.Get(fiber.HeaderContentType), ";")[0]),
+					strings.Join(sortedContentTypes(reqErr.RequestBody.Content), ", ")))
+				continue
+			}
+			violations = append(violations, kinBodyViolations(reqErr)...)
+		case errors.As(err, &reqErr) && reqErr.Parameter != nil:
+			violations = append(violations, kinParamViolations(reqErr)...)
+		default:
+			violations = append(violations, err.Error())
+		}
+	}
+	return status, violations
+}
+
+// flattenErrors unpacks kin-openapi's nested MultiErrors. Only the error
+// itself is checked: errors.As would reach through a RequestError into
+// the MultiError it wraps and lose the RequestError.
+func flattenErrors(err error) []error {
+	me, ok := err.(openapi3.MultiError)
+	if !ok {
+		return []error{err}
+	}
+	var errs []error
+	for _, e := range me {
+		errs = append(errs, flattenErrors(e)...)
+	}
+	return errs
+}
+
+// kinBodyViolations words a request body error the way validateBody does.
+func kinBodyViolations(reqErr *openapi3filter.RequestError) []string {
+	if errors.Is(reqErr.Err, openapi3filter.ErrInvalidRequired) {
+		return []string{"Body parameter is required, but the body is empty"}
+	}
+	if reqErr.Err == nil {
+		return []string{"request.body " + reqErr.Reason}
+	}
+
+	var violations []string
+	for _, err := range flattenErrors(reqErr.Err) {
+		var schemaErr *openapi3.SchemaError
+		if !errors.As(err, &schemaErr) {
+			violations = append(violations, "request.body "+reqErr.Reason+": "+err.Error())
+			continue
+		}
+		ptr := schemaErr.JSONPointer()
+		switch {
+		case schemaErr.SchemaField == "required" && len(ptr) == 1:
+			violations = append(violations, fmt.Sprintf("request.body Request body must have required property '%s'", ptr[0]))
+		case len(ptr) > 0:
+			violations = append(violations, fmt.Sprintf("request.body Property \"%s\": %s", strings.Join(ptr, "."), schemaErr.Reason))
+		default:
+			violations = append(violations, "request.body Request body: "+schemaErr.Reason)
+		}
+	}
+	return violations
+}
+
+// kinParamViolations words a parameter error the way STEP 3 does.
+func kinParamViolations(reqErr *openapi3filter.RequestError) []string {
+	p := reqErr.Parameter
+	if errors.Is(reqErr.Err, openapi3filter.ErrInvalidRequired) {
+		return []string{fmt.Sprintf("Required %s parameter \"%s\" is missing", p.In, p.Name)}
+	}
+	in := strings.ToUpper(p.In[:1]) + p.In[1:]
+
+	var violations []string
+	for _, err := range flattenErrors(reqErr.Err) {
+		var schemaErr *openapi3.SchemaError
+		reason := err.Error()
+		if errors.As(err, &schemaErr) {
+			reason = schemaErr.Reason
+		}
+		violations = append(violations, fmt.Sprintf("%s parameter \"%s\": %s", in, p.Name, reason))
+	}
+	if len(violations) == 0 {
+		violations = append(violations, fmt.Sprintf("%s parameter \"%s\": %s", in, p.Name, reqErr.Reason))
+	}
+	return violations
+}
+
+// kinSchemaMessage words a schema violation without the schema and value
+// dumps kin-openapi appends by default.
+func kinSchemaMessage(err *openapi3.SchemaError) string {
+	if ptr := err.JSONPointer(); len(ptr) > 0 {
+		return fmt.Sprintf("Error at %q: %s", "/"+strings.Join(ptr, "/"), err.Reason)
+	}
+	return err.Reason
+}
+
+// Outcomes of a failed --validate-responses check, set with
+// --invalid-responses.
+const (
+	InvalidResponsesWarn = "warn" // log the violations and send the response anyway
+	InvalidResponsesFail = "fail" // replace the response with a 500
+)
+
+// kinValidateResponse checks the JSON response about to be sent with
+// openapi3filter.ValidateResponse (--validate-responses) and returns its
+// violations. Streamed, binary and text responses aren't checked, nor are
+// statuses the operation doesn't declare.
+func kinValidateResponse(c *fiber.Ctx, method, specPath string, op *openapi3.Operation) []string {
+	resp := c.Response()
+	if op == nil || resp.IsBodyStream() || !isJSONMediaType(string(resp.Header.ContentType())) {
+		return nil
+	}
+	req, route, params, err := kinRoute(c, method, specPath, op)
+	if err != nil || route.Operation == nil {
+		return nil
+	}
+
+	header := http.Header{}
+	resp.Header.VisitAll(func(k, v []byte) {
+		header.Add(string(k), string(v))
+	})
+	options := &openapi3filter.Options{MultiError: true}
+	options.WithCustomSchemaErrorFunc(kinSchemaMessage)
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: params,
+			Route:      route,
+			Options:    options,
+		},
+		Status:  resp.StatusCode(),
+		Header:  header,
+		Options: options,
+	}
+	input.SetBodyBytes(resp.Body())
+
+	err = openapi3filter.ValidateResponse(c.Context(), input)
+	if err == nil {
+		return nil
+	}
+	var violations []string
+	for _, err := range flattenErrors(err) {
+		var respErr *openapi3filter.ResponseError
+		if !errors.As(err, &respErr) || respErr.Err == nil {
+			violations = append(violations, "response "+err.Error())
+			continue
+		}
+		for _, err := range flattenErrors(respErr.Err) {
+			var schemaErr *openapi3.SchemaError
+			if !errors.As(err, &schemaErr) {
+				violations = append(violations, "response.body "+respErr.Reason+": "+err.Error())
+				continue
+			}
+			if ptr := schemaErr.JSONPointer(); len(ptr) > 0 {
+				violations = append(violations, fmt.Sprintf("response.body Property \"%s\": %s", strings.Join(ptr, "."), schemaErr.Reason))
+			} else {
+				violations = append(violations, "response.body Response body: "+schemaErr.Reason)
+			}
+		}
+	}
+	return violations
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// matchLanguage picks the tag from available that best fits an
+// Accept-Language header, following RFC 4647 lookup: ranges are tried by
+// weight, and a range such as "fr-CA" falls back to "fr" before the next
+// range is tried. Tags compare case-insensitively; "*" and ranges weighted 0
+// never match.
+func matchLanguage(header string, available []string) (string, bool) {
+	ranges := parseAccept(header)
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].Q > ranges[j].Q })
+
+	for _, r := range ranges {
+		if r.Q == 0 || r.Range == "*" {
+			continue
+		}
+		for tag := r.Range; tag != ""; tag = truncateLanguage(tag) {
+			for _, name := range available {
+				if strings.EqualFold(name, tag) {
+					return name, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// truncateLanguage drops the last subtag of a language tag: "zh-Hant-TW"
+// becomes "zh-Hant", and "zh" becomes "".
+func truncateLanguage(tag string) string {
+	i := strings.LastIndexByte(tag, '-')
+	if i < 0 {
+		return ""
+	}
+	return tag[:i]
+}
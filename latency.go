@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Latency distributions accepted by --latency-dist.
+const (
+	DistNormal      = "normal"
+	DistExponential = "exponential"
+)
+
+// latencyDist samples response delays from a distribution.
+type latencyDist struct {
+	Kind   string        // DistNormal or DistExponential
+	Mean   time.Duration // mean of either distribution
+	StdDev time.Duration // normal only
+}
+
+// parseLatencyDist reads a --latency-dist value: "normal:<mean>:<stddev>",
+// e.g. "normal:200ms:50ms", or "exponential:<mean>", e.g.
+// "exponential:200ms".
+func parseLatencyDist(s string) (*latencyDist, error) {
+	parts := strings.Split(s, ":")
+	d := &latencyDist{Kind: strings.ToLower(parts[0])}
+
+	var want int
+	switch d.Kind {
+	case DistNormal:
+		want = 3
+	case DistExponential:
+		want = 2
+	default:
+		return nil, fmt.Errorf("unknown distribution %q (want normal:<mean>:<stddev> or exponential:<mean>)", parts[0])
+	}
+	if len(parts) != want {
+		return nil, fmt.Errorf("%q: want normal:<mean>:<stddev> or exponential:<mean>", s)
+	}
+
+	durations := make([]time.Duration, 0, 2)
+	for _, p := range parts[1:] {
+		v, err := time.ParseDuration(p)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", s, err)
+		}
+		if v < 0 {
+			return nil, fmt.Errorf("%q: durations must not be negative", s)
+		}
+		durations = append(durations, v)
+	}
+	d.Mean = durations[0]
+	if d.Kind == DistNormal {
+		d.StdDev = durations[1]
+	}
+	return d, nil
+}
+
+// sample draws one delay, from rng if set. It may be negative for the
+// normal distribution; routeDelay clamps it.
+func (d *latencyDist) sample(rng *rand.Rand) time.Duration {
+	norm, exp := rand.NormFloat64, rand.ExpFloat64
+	if rng != nil {
+		norm, exp = rng.NormFloat64, rng.ExpFloat64
+	}
+	switch d.Kind {
+	case DistNormal:
+		return d.Mean + time.Duration(norm()*float64(d.StdDev))
+	case DistExponential:
+		return time.Duration(exp() * float64(d.Mean))
+	}
+	return 0
+}
+
+// String describes the distribution for the startup log.
+func (d *latencyDist) String() string {
+	if d.Kind == DistNormal {
+		return fmt.Sprintf("normal, mean %s, stddev %s", d.Mean, d.StdDev)
+	}
+	return fmt.Sprintf("exponential, mean %s", d.Mean)
+}
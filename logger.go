@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 // ANSI color codes for terminal output
@@ -20,6 +21,43 @@ const (
 	LogSuccess = "✔  success"
 )
 
+// Verbosity thresholds for per-request logging, from most to least chatty.
+const (
+	LevelInfo = iota
+	LevelWarning
+	LevelError
+	LevelSilent
+)
+
+// logLevel is the minimum level printed by every Logger. Set from --log-level.
+var logLevel = LevelInfo
+
+// ParseLogLevel converts a --log-level value into a threshold.
+func ParseLogLevel(s string) (int, error) {
+	switch strings.ToLower(s) {
+	case "info", "":
+		return LevelInfo, nil
+	case "warning", "warn":
+		return LevelWarning, nil
+	case "error":
+		return LevelError, nil
+	case "silent", "none":
+		return LevelSilent, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (want info, warning, error or silent)", s)
+}
+
+// levelOf maps a log symbol onto its verbosity threshold.
+func levelOf(level string) int {
+	switch level {
+	case LogWarning:
+		return LevelWarning
+	case LogError:
+		return LevelError
+	}
+	return LevelInfo
+}
+
 // Logger components
 const (
 	ComponentHTTPServer = "HTTP SERVER"
@@ -28,19 +66,44 @@ const (
 )
 
 // Logger provides structured logging similar to Prism CLI.
+// Every line is prefixed with the request id so interleaved requests can be
+// told apart.
 type Logger struct {
-	indent string
+	indent      string
+	requestID   string
+	operationID string // shown on the request lines when the spec names the operation
 }
 
-// NewLogger creates a new Logger.
-func NewLogger() *Logger {
-	return &Logger{indent: "    "}
+// NewLogger creates a new Logger for the request identified by requestID.
+func NewLogger(requestID string) *Logger {
+	return &Logger{indent: "    ", requestID: requestID}
+}
+
+// prefix returns the request id tag that starts every line.
+func (l *Logger) prefix() string {
+	if l.requestID == "" {
+		return ""
+	}
+	return "[" + l.requestID + "] "
+}
+
+// operation returns the operationId tag of the request lines.
+func (l *Logger) operation() string {
+	if l.operationID == "" {
+		return ""
+	}
+	return l.operationID + " "
 }
 
 // RequestReceived prints the first line like Prism.
 func (l *Logger) RequestReceived(method, path string) {
-	fmt.Printf("[%s] %s %s %s   %s\n",
+	if logLevel > LevelInfo {
+		return
+	}
+	fmt.Printf("%s[%s] %s%s %s %s   %s\n",
+		l.prefix(),
 		ComponentHTTPServer,
+		l.operation(),
 		strings.ToLower(method),
 		path,
 		LogInfo,
@@ -49,6 +112,10 @@ func (l *Logger) RequestReceived(method, path string) {
 }
 
 func (l *Logger) log(component, level, message string) {
+	if levelOf(level) < logLevel {
+		return
+	}
+
 	var colorCode string
 	switch level {
 	case LogWarning:
@@ -60,9 +127,9 @@ func (l *Logger) log(component, level, message string) {
 	}
 
 	if colorCode != "" {
-		fmt.Printf("%s[%s] %s%s%s   %s\n", l.indent, component, colorCode, level, colorReset, message)
+		fmt.Printf("%s%s[%s] %s%s%s   %s\n", l.indent, l.prefix(), component, colorCode, level, colorReset, message)
 	} else {
-		fmt.Printf("%s[%s] %s   %s\n", l.indent, component, level, message)
+		fmt.Printf("%s%s[%s] %s   %s\n", l.indent, l.prefix(), component, level, message)
 	}
 }
 
@@ -88,6 +155,11 @@ func (l *Logger) Success(component, message string) {
 
 // RespondWith emits the standard Prism negotiation block.
 func (l *Logger) RespondWith(statusCode int) {
+	// Every line here is info-level; skip formatting them when they'd be
+	// dropped anyway.
+	if logLevel > LevelInfo {
+		return
+	}
 	l.Success(ComponentNegotiator, fmt.Sprintf("Found response %d. I'll try with it.", statusCode))
 	l.Success(ComponentNegotiator, fmt.Sprintf("The response %d has a schema. I'll keep going with this one", statusCode))
 	l.Success(ComponentNegotiator, fmt.Sprintf("Responding with the requested status code %d", statusCode))
@@ -98,3 +170,19 @@ func (l *Logger) RespondWith(statusCode int) {
 func (l *Logger) Violation(message string) {
 	l.Error(ComponentValidator, "Violation: request "+message)
 }
+
+// Summary prints the one-line wrap-up for a finished request.
+func (l *Logger) Summary(method, path string, statusCode int, elapsed time.Duration) {
+	if logLevel > LevelInfo {
+		return
+	}
+	fmt.Printf("%s[%s] %s%s %s %d %dms\n",
+		l.prefix(),
+		ComponentHTTPServer,
+		l.operation(),
+		strings.ToUpper(method),
+		path,
+		statusCode,
+		elapsed.Milliseconds(),
+	)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// BenchmarkRequestLogging logs what a typical request logs, at the default
+// info level and with --quiet, writing to /dev/null.
+func BenchmarkRequestLogging(b *testing.B) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer devNull.Close()
+	stdout, level := os.Stdout, logLevel
+	os.Stdout = devNull
+	defer func() { os.Stdout, logLevel = stdout, level }()
+
+	for _, bench := range []struct {
+		name  string
+		level int
+	}{
+		{"info", LevelInfo},
+		{"quiet", LevelSilent},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			logLevel = bench.level
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				logger := NewLogger("0b6a4f0e-6c1f-4a3a-9d55-2f0f5e1f2a10")
+				logger.RequestReceived("GET", "/users/1")
+				logger.Info(ComponentNegotiator, "Request contains an accept header: application/json")
+				logger.Success(ComponentValidator, "Request passed all validation rules")
+				logger.RespondWith(200)
+				logger.Summary("GET", "/users/1", 200, time.Millisecond)
+			}
+		})
+	}
+}
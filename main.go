@@ -5,27 +5,372 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
 )
 
 func main() {
 	if len(os.Args) < 3 {
 		fmt.Println("Usage:")
-		fmt.Println("  mock-server mock <openapi.yaml> [--port 3000] [--data data.json]")
+		fmt.Println("  mock-server mock <openapi.yaml> [--port 3000] [--data data.json] [--log-level info] [--error-format default] [--metrics] [--access-log combined] [--compress] [--max-body-size 1mb] [--cors] [--admin]")
+		fmt.Println("  mock-server scaffold-data <openapi.yaml> [-o data.json] [--force]")
 		os.Exit(1)
 	}
 
-	cmd := os.Args[1]
-	if cmd != "mock" {
+	switch cmd := os.Args[1]; cmd {
+	case "mock":
+	case "scaffold-data":
+		runScaffoldData(os.Args[2], os.Args[3:])
+		return
+	default:
 		log.Fatalf("unknown command: %s", cmd)
 	}
 
 	openapiFile := os.Args[2]
 
 	fs := flag.NewFlagSet("mock", flag.ExitOnError)
+	configFile := fs.String("config", "", "YAML or JSON file of flag values keyed by flag name; command-line flags win")
 	port := fs.Int("port", 3000, "server port")
-	dataFile := fs.String("data", "data.json", "data storage file")
+	var dataFiles stringList
+	fs.Var(&dataFiles, "data", "data storage file (default data.json); repeat to merge more files over the first, which is the one written")
+	noPersist := fs.Bool("no-persist", false, "keep changes in memory and never write the data file")
+	level := fs.String("log-level", "info", "per-request log level: info, warning, error or silent")
+	quiet := fs.Bool("quiet", false, "turn off per-request logging; same as --log-level silent")
+	errFormat := fs.String("error-format", "default", "error body shape: default or problem (RFC 7807)")
+	withMetrics := fs.Bool("metrics", false, "expose Prometheus metrics at /metrics")
+	accessLog := fs.String("access-log", "", "emit an NCSA access log: common or combined")
+	accessLogFile := fs.String("access-log-file", "", "write the access log to this file instead of stdout")
+	compressed := fs.Bool("compress", false, "gzip/deflate/brotli responses when the client accepts it")
+	maxBody := fs.String("max-body-size", "", "reject request bodies larger than this with 413, e.g. 512kb or 1mb")
+	methodStatus := map[string]*int{
+		fiber.MethodPost:   fs.Int("post-status", 0, "success status for POST (default 201)"),
+		fiber.MethodPut:    fs.Int("put-status", 0, "success status for PUT (default 200)"),
+		fiber.MethodPatch:  fs.Int("patch-status", 0, "success status for PATCH (default 200)"),
+		fiber.MethodDelete: fs.Int("delete-status", 0, "success status for DELETE (default 204)"),
+	}
+	var routeStatus statusOverrides
+	fs.Var(&routeStatus, "status", `per-route success status, e.g. "POST /orders=202" (repeatable)`)
+	caseInsensitive := fs.Bool("case-insensitive", true, "match routes regardless of letter case")
+	readOnly := fs.Bool("readonly", false, "reject POST/PUT/PATCH/DELETE with 405 and never write the data file")
+	serverIDs := fs.Bool("server-ids", false, "reject POST bodies that carry an id instead of keeping it")
+	rejectDeprecated := fs.Bool("reject-deprecated", false, "answer operations marked deprecated with 410 Gone")
+	checkExamplesFlag := fs.Bool("check-examples", false, "validate request/response examples against their schemas at startup")
+	skipSpecValidation := fs.Bool("skip-spec-validation", false, "start even if the spec fails validation, logging the errors instead")
+	exposeSpec := fs.Bool("expose-spec", false, "serve the loaded spec at /openapi.json and /openapi.yaml")
+	docs := fs.Bool("docs", false, "serve Swagger UI (implies --expose-spec)")
+	docsPath := fs.String("docs-path", "/docs", "where --docs serves Swagger UI")
+	latency := fs.Duration("latency", 0, "delay every response by this long, e.g. 200ms; --timing entries win")
+	latencyDistFlag := fs.String("latency-dist", "", "sample delays from normal:<mean>:<stddev> or exponential:<mean>, e.g. normal:200ms:50ms")
+	latencyMax := fs.Duration("latency-max", 0, "cap every delay at this long, e.g. 2s")
+	delayJitter := fs.Duration("delay-jitter", 0, "spread each delay uniformly over ± this long, e.g. 50ms")
+	throttle := fs.String("throttle", "", "stream response bodies over 1KB at this bandwidth, e.g. 100kbps or 2mbps")
+	timingFile := fs.String("timing", "", "JSON/YAML file of per-route delays, e.g. {\"GET /users\": \"200ms\"}")
+	scenariosFile := fs.String("scenarios", "", "JSON/YAML file of named response sets selected with the X-Mock-Scenario header")
+	routesFile := fs.String("routes", "", "JSON/YAML file of static responses for routes outside the spec")
+	allowStatusOverride := fs.Bool("allow-status-override", false, "let ?__status=<code> force any response status the operation declares")
+	defaultLimit := fs.Int("default-limit", defaultPageLimit, "page size for collection GETs that give _page without _limit")
+	maxLimit := fs.Int("max-limit", 0, "largest _limit honoured on collection GETs; 0 means no cap")
+	pagination := fs.String("pagination", PaginationPage, "collection paging: page (_page/_limit) or cursor (?cursor=, {data, nextCursor} bodies)")
+	envelope := fs.String("envelope", EnvelopeNone, "wrap GET responses as {data, meta}: none, collections or all")
+	useParamExamples := fs.Bool("use-param-examples", false, "fill missing query parameters from their declared examples instead of rejecting them")
+	fakerSeed := fs.Int64("faker-seed", 0, "seed for generated data, so Prefer: dynamic=true responses repeat across runs")
+	validator := fs.String("validator", ValidatorBuiltin, "request validation engine: builtin, or kin for kin-openapi's openapi3filter")
+	useKinValidation := fs.Bool("use-kin-validation", false, "same as --validator kin")
+	validateResponses := fs.Bool("validate-responses", false, "check every JSON response against its declared schema with openapi3filter")
+	invalidResponses := fs.String("invalid-responses", InvalidResponsesWarn, "what --validate-responses does with a mismatch: warn (log it) or fail (answer 500)")
+	strictQuery := fs.Bool("strict-query", false, "reject query parameters the operation doesn't declare with 400")
+	coerceTypes := fs.Bool("coerce-types", false, "convert numeric and boolean strings in JSON bodies to the type their schema declares before validating")
+	rejectEmptyBody := fs.Bool("reject-empty-body", false, "answer empty, whitespace-only or null bodies with 400 even when the body is optional")
+	printRoutes := fs.Bool("print-routes", false, "print the routes the spec would expose and exit")
+	admin := fs.Bool("admin", false, "enable the /__admin control endpoints")
+	cors := fs.Bool("cors", false, "enable CORS headers and preflight handling")
+	corsOrigins := fs.String("cors-origins", "*", "comma-separated list of allowed origins")
+	corsCredentials := fs.Bool("cors-credentials", false, "send Access-Control-Allow-Credentials and echo the origin")
+	corsHeaders := fs.String("cors-headers", "", "allowed request headers; empty reflects the preflight's requested headers")
+	corsMaxAge := fs.Int("cors-max-age", 600, "seconds browsers may cache a preflight response; 0 omits Access-Control-Max-Age")
 
 	_ = fs.Parse(os.Args[3:])
 
-	startServer(openapiFile, *dataFile, *port)
+	if err := applyEnv(fs); err != nil {
+		log.Fatalf("invalid environment: %v", err)
+	}
+	if *configFile != "" {
+		if err := applyConfig(fs, *configFile); err != nil {
+			log.Fatalf("invalid --config: %v", err)
+		}
+	}
+
+	lvl, err := ParseLogLevel(*level)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logLevel = lvl
+	if *quiet {
+		logLevel = LevelSilent
+	}
+
+	if errorFormat, err = ParseErrorFormat(*errFormat); err != nil {
+		log.Fatal(err)
+	}
+
+	maxBodySize, err := parseByteSize(*maxBody)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(dataFiles) == 0 {
+		dataFiles = stringList{"data.json"}
+	}
+	for _, f := range dataFiles[1:] {
+		if _, err := os.Stat(f); err != nil {
+			log.Fatalf("invalid --data: %v", err)
+		}
+	}
+
+	methodStatuses := map[string]int{}
+	for method, code := range methodStatus {
+		if *code == 0 {
+			continue
+		}
+		if *code < 200 || *code > 299 {
+			log.Fatalf("--%s-status must be a 2xx code, got %d", strings.ToLower(method), *code)
+		}
+		methodStatuses[method] = *code
+	}
+
+	if *latency < 0 || *delayJitter < 0 || *latencyMax < 0 {
+		log.Fatalf("--latency, --delay-jitter and --latency-max must not be negative")
+	}
+	var latencyDist *latencyDist
+	if *latencyDistFlag != "" {
+		if *latency > 0 {
+			log.Fatalf("use either --latency or --latency-dist, not both")
+		}
+		if latencyDist, err = parseLatencyDist(*latencyDistFlag); err != nil {
+			log.Fatalf("invalid --latency-dist: %v", err)
+		}
+	}
+
+	if *corsMaxAge < 0 {
+		log.Fatalf("--cors-max-age must not be negative")
+	}
+
+	var throttleRate int
+	if *throttle != "" {
+		if throttleRate, err = parseBandwidth(*throttle); err != nil {
+			log.Fatalf("invalid --throttle: %v", err)
+		}
+	}
+
+	var timing map[string]time.Duration
+	if *timingFile != "" {
+		if timing, err = loadTiming(*timingFile); err != nil {
+			log.Fatalf("invalid --timing: %v", err)
+		}
+	}
+
+	var scenarios map[string]map[string]scenario
+	if *scenariosFile != "" {
+		if scenarios, err = loadScenarios(*scenariosFile); err != nil {
+			log.Fatalf("invalid --scenarios: %v", err)
+		}
+	}
+
+	var cannedRoutes map[string]scenario
+	if *routesFile != "" {
+		if cannedRoutes, err = loadCannedRoutes(*routesFile); err != nil {
+			log.Fatalf("invalid --routes: %v", err)
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "faker-seed" {
+			seedFaker(*fakerSeed)
+		}
+	})
+
+	switch *pagination {
+	case PaginationPage, PaginationCursor:
+	default:
+		log.Fatalf("unknown pagination mode %q (want page or cursor)", *pagination)
+	}
+
+	switch *validator {
+	case ValidatorBuiltin, ValidatorKin:
+	default:
+		log.Fatalf("unknown validator %q (want builtin or kin)", *validator)
+	}
+	if *useKinValidation {
+		*validator = ValidatorKin
+	}
+	switch *invalidResponses {
+	case InvalidResponsesWarn, InvalidResponsesFail:
+	default:
+		log.Fatalf("unknown --invalid-responses mode %q (want warn or fail)", *invalidResponses)
+	}
+
+	switch *envelope {
+	case EnvelopeNone, EnvelopeCollections, EnvelopeAll:
+	default:
+		log.Fatalf("unknown envelope %q (want none, collections or all)", *envelope)
+	}
+
+	switch *accessLog {
+	case "", "common", "combined":
+	default:
+		log.Fatalf("unknown access log format %q (want common or combined)", *accessLog)
+	}
+
+	opts := &Options{
+		Port:     *port,
+		DataFile: dataFiles[0],
+		Metrics:  *withMetrics,
+
+		DataOverlays: dataFiles[1:],
+		NoPersist:    *noPersist,
+
+		AccessLog:     *accessLog,
+		AccessLogFile: *accessLogFile,
+		Compress:      *compressed,
+		MaxBodySize:   maxBodySize,
+
+		CaseInsensitive: *caseInsensitive,
+		ReadOnly:        *readOnly,
+		ServerIDs:       *serverIDs,
+
+		RejectDeprecated: *rejectDeprecated,
+		CheckExamples:    *checkExamplesFlag,
+
+		SkipSpecValidation: *skipSpecValidation,
+		UseParamExamples:   *useParamExamples,
+		RejectEmptyBody:    *rejectEmptyBody,
+
+		AllowStatusOverride: *allowStatusOverride,
+		StrictQuery:         *strictQuery,
+		CoerceTypes:         *coerceTypes,
+		Validator:           *validator,
+		ValidateResponses:   *validateResponses,
+		InvalidResponses:    *invalidResponses,
+
+		DefaultLimit: *defaultLimit,
+		MaxLimit:     *maxLimit,
+		Pagination:   *pagination,
+		Envelope:     *envelope,
+		ExposeSpec:   *exposeSpec,
+
+		MethodStatus: methodStatuses,
+		RouteStatus:  routeStatus,
+
+		Timing:      timing,
+		Latency:     *latency,
+		LatencyDist: latencyDist,
+		DelayJitter: *delayJitter,
+		LatencyMax:  *latencyMax,
+		Throttle:    throttleRate,
+		Scenarios:   scenarios,
+		Routes:      cannedRoutes,
+
+		Admin: *admin,
+
+		CORS:            *cors || *corsCredentials || *corsHeaders != "",
+		CORSOrigins:     splitList(*corsOrigins),
+		CORSCredentials: *corsCredentials,
+		CORSHeaders:     *corsHeaders,
+		CORSMaxAge:      *corsMaxAge,
+	}
+	if *docs {
+		opts.DocsPath = "/" + strings.TrimPrefix(*docsPath, "/")
+	}
+
+	if *printRoutes {
+		for _, e := range Endpoints(loadSpec(openapiFile, opts)) {
+			fmt.Println(e)
+		}
+		return
+	}
+
+	startServer(openapiFile, opts)
+}
+
+// parseByteSize turns a human-readable size such as "512kb" or "1mb" into a
+// byte count. A bare number is taken as bytes; an empty string yields 0.
+func parseByteSize(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+
+	units := []struct {
+		suffix string
+		scale  int
+	}{
+		{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10},
+		{"g", 1 << 30}, {"m", 1 << 20}, {"k", 1 << 10},
+		{"b", 1},
+	}
+	scale := 1
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			scale = u.scale
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int(n * float64(scale)), nil
+}
+
+// splitList splits a comma-separated flag value, dropping blanks.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// stringList collects a repeatable string flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// statusOverrides collects repeatable --status "METHOD /path=code" flags.
+// The route may also be an operationId, as in "createUser=201".
+type statusOverrides map[string]int
+
+func (s *statusOverrides) String() string {
+	return fmt.Sprint(map[string]int(*s))
+}
+
+func (s *statusOverrides) Set(v string) error {
+	route, code, ok := strings.Cut(v, "=")
+	key, err := parseRouteKey(route)
+	if !ok || err != nil {
+		return fmt.Errorf(`want "METHOD /path=code" or "operationId=code", got %q`, v)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(code))
+	if err != nil || n < 200 || n > 299 {
+		return fmt.Errorf("status for %s must be a 2xx code, got %q", route, code)
+	}
+	if *s == nil {
+		*s = statusOverrides{}
+	}
+	(*s)[key] = n
+	return nil
 }
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// mockMatchers holds the parsed x-mock-matchers of every operation, filled
+// by compileExtensions.
+var mockMatchers = map[*openapi3.Operation][]matcher{}
+
+// matcher is one x-mock-matchers entry: a request carrying Query, Headers
+// and Body is answered with Status and Value instead of the store.
+type matcher struct {
+	Query     map[string]string // exact query parameter values
+	Headers   map[string]string // exact header values, by case-insensitive name
+	Present   map[string]bool   // headers that must be sent (true) or not (false)
+	Body      any               // fields the JSON body must contain, or equal with ExactBody
+	HasBody   bool
+	ExactBody bool
+
+	Status   int
+	Response *openapi3.Response // the declared response for Status, if any
+	Value    any
+}
+
+// compileMatchers parses an operation's x-mock-matchers, e.g.
+//
+//	x-mock-matchers:
+//	  - when: {query: {tier: gold}}
+//	    then: {status: 200, example: gold}
+//	  - when: {body: {sku: ABC-1}, bodyMatch: exact}
+//	    then: {status: 409, body: {message: already ordered}}
+//	  - when: {headers: {X-Client-Version: "1.0", Authorization: false}}
+//	    then: {status: 200, example: legacy}
+//
+// A header given true or false only has to be sent or left out.
+// then.example names one of the named examples of the response declared for
+// then.status; then.body gives the body literally. Status defaults to 200.
+func compileMatchers(where string, op *openapi3.Operation) error {
+	raw, ok := op.Extensions[extMatchers]
+	if !ok {
+		return nil
+	}
+	entries, ok := raw.([]any)
+	if !ok {
+		return fmt.Errorf("%s: %s must be a list of {when, then} entries", where, extMatchers)
+	}
+
+	matchers := make([]matcher, 0, len(entries))
+	for i, e := range entries {
+		entry, _ := e.(map[string]any)
+		when, _ := entry["when"].(map[string]any)
+		then, _ := entry["then"].(map[string]any)
+		if when == nil || then == nil {
+			return fmt.Errorf("%s: %s[%d] needs a when and a then object", where, extMatchers, i)
+		}
+
+		m := matcher{Status: fiber.StatusOK}
+		if q, ok := when["query"].(map[string]any); ok {
+			m.Query = make(map[string]string, len(q))
+			for k, v := range q {
+				s, err := configValue(v)
+				if err != nil {
+					return fmt.Errorf("%s: %s[%d].when.query.%s: %v", where, extMatchers, i, k, err)
+				}
+				m.Query[k] = s
+			}
+		}
+		if h, ok := when["headers"].(map[string]any); ok {
+			m.Headers, m.Present = map[string]string{}, map[string]bool{}
+			for k, v := range h {
+				if present, ok := v.(bool); ok {
+					m.Present[k] = present
+					continue
+				}
+				s, err := configValue(v)
+				if err != nil {
+					return fmt.Errorf("%s: %s[%d].when.headers.%s: %v", where, extMatchers, i, k, err)
+				}
+				m.Headers[k] = s
+			}
+		}
+		m.Body, m.HasBody = when["body"]
+		switch mode := when["bodyMatch"]; mode {
+		case nil, "partial":
+		case "exact":
+			m.ExactBody = true
+		default:
+			return fmt.Errorf("%s: %s[%d].when.bodyMatch must be partial or exact, got %v", where, extMatchers, i, mode)
+		}
+
+		if status, ok := then["status"].(float64); ok {
+			m.Status = int(status)
+		}
+		if m.Status < 100 || m.Status > 599 {
+			return fmt.Errorf("%s: %s[%d]: invalid status %d", where, extMatchers, i, m.Status)
+		}
+		m.Response, _ = declaredResponse(op, m.Status)
+		if name, ok := then["example"].(string); ok {
+			v, found := namedExample(m.Response, name)
+			if !found {
+				return fmt.Errorf("%s: %s[%d]: response %d has no example named %q", where, extMatchers, i, m.Status, name)
+			}
+			m.Value = v
+		} else {
+			m.Value = then["body"]
+		}
+		matchers = append(matchers, m)
+	}
+	mockMatchers[op] = matchers
+	return nil
+}
+
+// namedExample looks up a named example across a response's media types.
+func namedExample(resp *openapi3.Response, name string) (any, bool) {
+	if resp == nil {
+		return nil, false
+	}
+	for _, ct := range sortedContentTypes(resp.Content) {
+		if ref := resp.Content[ct].Examples[name]; ref != nil && ref.Value != nil {
+			return ref.Value.Value, true
+		}
+	}
+	return nil, false
+}
+
+// matchRequest returns the first of op's matchers that the request fits.
+func matchRequest(c *fiber.Ctx, op *openapi3.Operation, payload any) (matcher, int, bool) {
+	for i, m := range mockMatchers[op] {
+		if m.matches(c, payload) {
+			return m, i, true
+		}
+	}
+	return matcher{}, 0, false
+}
+
+// matches reports whether the request carries every query value and header
+// m lists and a body containing (or, with ExactBody, equal to) m.Body.
+func (m matcher) matches(c *fiber.Ctx, payload any) bool {
+	for k, v := range m.Query {
+		if c.Query(k) != v {
+			return false
+		}
+	}
+	for k, v := range m.Headers {
+		if got := c.Request().Header.Peek(k); got == nil || string(got) != v {
+			return false
+		}
+	}
+	for k, present := range m.Present {
+		if (c.Request().Header.Peek(k) != nil) != present {
+			return false
+		}
+	}
+	if !m.HasBody {
+		return true
+	}
+	if m.ExactBody {
+		return reflect.DeepEqual(m.Body, payload)
+	}
+	return containsJSON(payload, m.Body)
+}
+
+// containsJSON reports whether got contains want: objects may carry extra
+// fields at any depth, while arrays must have the same length and match
+// item by item. A key of want that got lacks is read as a dotted path, so
+// {"user.name": "alice"} matches {"user": {"name": "alice"}} and
+// "items.0.sku" reaches into an array.
+func containsJSON(got, want any) bool {
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			return false
+		}
+		for k, wv := range w {
+			gv, ok := g[k]
+			if !ok {
+				gv, ok = lookupPath(g, k)
+			}
+			if !ok || !containsJSON(gv, wv) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		g, ok := got.([]any)
+		if !ok || len(g) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !containsJSON(g[i], w[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+// lookupPath follows a dotted path such as "user.address.city" or
+// "items.0.sku" through objects and arrays.
+func lookupPath(v any, path string) (any, bool) {
+	if !strings.Contains(path, ".") {
+		return nil, false
+	}
+	for _, seg := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			next, ok := node[seg]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// send writes the matched response in the media type Accept picks from
+// those the response declares, JSON by default.
+func (m matcher) send(c *fiber.Ctx) error {
+	contentType, ok := negotiate(c.Get(fiber.HeaderAccept), offeredContentTypes(m.Response))
+	if !ok {
+		contentType = fiber.MIMEApplicationJSON
+	}
+	if m.Value == nil {
+		return c.SendStatus(m.Status)
+	}
+	return resolvedBody{Status: m.Status, ContentType: contentType, Value: m.Value}.send(c)
+}
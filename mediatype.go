@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// mediaType is a parsed "type/subtype+suffix" media range. Parameters such as
+// charset are dropped.
+type mediaType struct {
+	Type, Subtype, Suffix string
+}
+
+// parseMediaType splits a Content-Type value into its structured parts,
+// lowercased.
+func parseMediaType(s string) mediaType {
+	s, _, _ = strings.Cut(s, ";")
+	s = strings.ToLower(strings.TrimSpace(s))
+	typ, sub, _ := strings.Cut(s, "/")
+	mt := mediaType{Type: typ, Subtype: sub}
+	if i := strings.LastIndexByte(sub, '+'); i >= 0 {
+		mt.Suffix = sub[i+1:]
+	}
+	return mt
+}
+
+// isJSON reports whether the media type carries JSON: application/json or
+// any structured "+json" type such as application/vnd.api+json.
+func (m mediaType) isJSON() bool {
+	return (m.Type == "application" && m.Subtype == "json") || m.Suffix == "json"
+}
+
+// isJSONMediaType reports whether a Content-Type value carries JSON.
+func isJSONMediaType(s string) bool {
+	return parseMediaType(s).isJSON()
+}
+
+// matchMediaType reports whether a request's Content-Type satisfies a media
+// type declared in the spec. Besides an exact match, application/json and
+// "+json" types of the same top-level type are interchangeable, so JSON:API
+// or HAL clients can hit a spec that only declares application/json and vice
+// versa, and declarations may use "type/*" or "*/*" wildcards.
+func matchMediaType(requested, declared string) bool {
+	return mediaTypeSpecificity(requested, declared) >= 0
+}
+
+// mediaTypeSpecificity ranks how closely a declared media type matches a
+// request: 3 for an exact match, 2 for a "+json" equivalence, 1 for
+// "type/*", 0 for "*/*" and -1 for no match.
+func mediaTypeSpecificity(requested, declared string) int {
+	req, decl := parseMediaType(requested), parseMediaType(declared)
+	switch {
+	case req.Type == decl.Type && req.Subtype == decl.Subtype:
+		return 3
+	case req.Type == decl.Type && req.isJSON() && decl.isJSON():
+		return 2
+	case req.Type == decl.Type && decl.Subtype == "*":
+		return 1
+	case decl.Type == "*" && decl.Subtype == "*":
+		return 0
+	}
+	return -1
+}
+
+// lookupMediaType finds the declared media type serving a request's
+// Content-Type, preferring the most specific declaration.
+func lookupMediaType(content openapi3.Content, requested string) (string, *openapi3.MediaType, bool) {
+	found, best := "", -1
+	for _, key := range sortedContentTypes(content) {
+		if score := mediaTypeSpecificity(requested, key); score > best {
+			found, best = key, score
+		}
+	}
+	if best < 0 {
+		return "", nil, false
+	}
+	return found, content[found], true
+}
+
+// acceptRange is one media range of an Accept header with its weight.
+type acceptRange struct {
+	Range string
+	Q     float64
+}
+
+// parseAccept splits an Accept header into its media ranges. A missing or
+// malformed q parameter counts as 1. Accept-Language parses the same way.
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		media, params, _ := strings.Cut(part, ";")
+		if media = strings.TrimSpace(media); media == "" {
+			continue
+		}
+		r := acceptRange{Range: media, Q: 1}
+		for _, param := range strings.Split(params, ";") {
+			k, v, _ := strings.Cut(param, "=")
+			if strings.EqualFold(strings.TrimSpace(k), "q") {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && q >= 0 && q <= 1 {
+					r.Q = q
+				}
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// negotiate picks the offered media type that the Accept header weighs
+// highest. Each offer takes the weight of the most specific range matching
+// it; ties go to the earlier offer, and a weight of 0 rules a type out. An
+// empty header accepts the first offer.
+func negotiate(accept string, offered []string) (string, bool) {
+	if len(offered) == 0 {
+		return "", false
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offered[0], true
+	}
+	ranges := parseAccept(accept)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offered {
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			if s := mediaTypeSpecificity(offer, r.Range); s > specificity {
+				q, specificity = r.Q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best, bestQ > 0
+}
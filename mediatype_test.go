@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+func TestMatchMediaType(t *testing.T) {
+	tests := []struct {
+		requested, declared string
+		want                bool
+	}{
+		{"application/json", "application/json", true},
+		{"application/json; charset=utf-8", "application/json", true},
+		{"application/json", "application/*", true},
+		{"application/xml", "application/*", true},
+		{"application/vnd.x+json", "application/*", true},
+		{"text/plain", "application/*", false},
+		{"application/json", "*/*", true},
+		{"text/plain", "*/*", true},
+		{"application/vnd.x+json", "*/*", true},
+		{"application/vnd.x+json", "application/json", true},
+		{"application/json", "application/vnd.x+json", true},
+		{"application/vnd.x+json", "application/vnd.y+json", true},
+		{"application/vnd.x+xml", "application/json", false},
+		{"application/xml", "application/json", false},
+		{"text/json", "application/json", false},
+	}
+	for _, tt := range tests {
+		if got := matchMediaType(tt.requested, tt.declared); got != tt.want {
+			t.Errorf("matchMediaType(%q, %q) = %v, want %v", tt.requested, tt.declared, got, tt.want)
+		}
+	}
+}
+
+func TestLookupMediaTypePrefersTheMostSpecific(t *testing.T) {
+	content := func(types ...string) openapi3.Content {
+		c := openapi3.Content{}
+		for _, typ := range types {
+			c[typ] = openapi3.NewMediaType()
+		}
+		return c
+	}
+	tests := []struct {
+		content   openapi3.Content
+		requested string
+		want      string
+	}{
+		{content("*/*", "application/*", "application/json"), "application/json", "application/json"},
+		{content("*/*", "application/*", "application/json"), "application/vnd.x+json", "application/json"},
+		{content("*/*", "application/*"), "application/vnd.x+json", "application/*"},
+		{content("*/*", "application/*"), "text/plain", "*/*"},
+		{content("application/vnd.x+json", "application/*"), "application/vnd.x+json", "application/vnd.x+json"},
+		{content("application/*"), "text/plain", ""},
+	}
+	for _, tt := range tests {
+		got, _, ok := lookupMediaType(tt.content, tt.requested)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("lookupMediaType(%v, %q) = %q, %v, want %q", sortedContentTypes(tt.content), tt.requested, got, ok, tt.want)
+		}
+	}
+}
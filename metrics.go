@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// metricsPath is where the Prometheus scrape endpoint is mounted.
+const metricsPath = "/metrics"
+
+// durationBuckets mirrors the Prometheus client's default histogram buckets.
+var durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metrics is nil unless --metrics is set.
+var metrics *Metrics
+
+type metricKey struct {
+	method string
+	path   string
+	status int
+}
+
+type histogram struct {
+	counts []uint64 // one per durationBuckets entry, cumulative at render time
+	sum    float64
+	count  uint64
+}
+
+// Metrics is a tiny in-process registry rendering the Prometheus text format.
+// It tracks a request counter and a latency histogram labeled by
+// method/path/status.
+type Metrics struct {
+	mu        sync.Mutex
+	requests  map[metricKey]uint64
+	durations map[metricKey]*histogram
+}
+
+// NewMetrics creates an empty registry.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:  map[metricKey]uint64{},
+		durations: map[metricKey]*histogram{},
+	}
+}
+
+// Observe records one finished request.
+func (m *Metrics) Observe(method, path string, status int, elapsed time.Duration) {
+	key := metricKey{method: strings.ToUpper(method), path: path, status: status}
+	seconds := elapsed.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[key]++
+
+	h := m.durations[key]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		m.durations[key] = h
+	}
+	for i, le := range durationBuckets {
+		if seconds <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// Render writes the registry in Prometheus exposition format.
+func (m *Metrics) Render() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]metricKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].path != keys[j].path {
+			return keys[i].path < keys[j].path
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	var b strings.Builder
+	b.WriteString("# HELP mock_http_requests_total Total number of requests handled by the mock.\n")
+	b.WriteString("# TYPE mock_http_requests_total counter\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "mock_http_requests_total{%s} %d\n", k.labels(), m.requests[k])
+	}
+
+	b.WriteString("# HELP mock_http_request_duration_seconds Request handling time in seconds.\n")
+	b.WriteString("# TYPE mock_http_request_duration_seconds histogram\n")
+	for _, k := range keys {
+		h := m.durations[k]
+		var cumulative uint64
+		for i, le := range durationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "mock_http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				k.labels(), strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(&b, "mock_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", k.labels(), h.count)
+		fmt.Fprintf(&b, "mock_http_request_duration_seconds_sum{%s} %g\n", k.labels(), h.sum)
+		fmt.Fprintf(&b, "mock_http_request_duration_seconds_count{%s} %d\n", k.labels(), h.count)
+	}
+	return b.String()
+}
+
+func (k metricKey) labels() string {
+	return fmt.Sprintf("method=%q,path=%q,status=\"%d\"", k.method, k.path, k.status)
+}
+
+// metricsHandler serves the registry. It bypasses handle, so scrapes are not
+// themselves counted.
+func metricsHandler(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return c.SendString(metrics.Render())
+}
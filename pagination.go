@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// Pagination query parameters, json-server style: ?_page=2&_limit=20, or
+// ?cursor=...&_limit=20 under --pagination cursor.
+const (
+	queryPage   = "_page"
+	queryLimit  = "_limit"
+	queryCursor = "cursor"
+)
+
+// Pagination modes selectable with --pagination.
+const (
+	PaginationPage   = "page"   // opt-in _page/_limit, bare array bodies
+	PaginationCursor = "cursor" // always paged, {"data": [...], "nextCursor": ...}
+)
+
+// defaultPageLimit is the page size used when only _page is given and
+// --default-limit isn't set.
+const defaultPageLimit = 10
+
+// pageRequest is a parsed _page/_limit pair.
+type pageRequest struct {
+	Page  int // 1-based
+	Limit int
+}
+
+// parsePage reads _page and _limit from a collection request. ok is false
+// when neither is present and the whole collection should be returned.
+// _limit falls back to --default-limit and is capped at --max-limit.
+func parsePage(c *fiber.Ctx, opts *Options) (p pageRequest, ok bool, err error) {
+	rawPage, rawLimit := c.Query(queryPage), c.Query(queryLimit)
+	if rawPage == "" && rawLimit == "" {
+		return p, false, nil
+	}
+
+	p.Page = 1
+	if rawPage != "" {
+		if p.Page, err = strconv.Atoi(rawPage); err != nil || p.Page < 1 {
+			return p, false, fmt.Errorf("%s must be a positive integer", queryPage)
+		}
+	}
+	if p.Limit, err = pageLimit(c, opts); err != nil {
+		return p, false, err
+	}
+	return p, true, nil
+}
+
+// pageLimit reads _limit, falling back to --default-limit and capping it at
+// --max-limit.
+func pageLimit(c *fiber.Ctx, opts *Options) (int, error) {
+	limit := opts.DefaultLimit
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if raw := c.Query(queryLimit); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("%s must be a positive integer", queryLimit)
+		}
+		limit = n
+	}
+	if opts.MaxLimit > 0 && limit > opts.MaxLimit {
+		limit = opts.MaxLimit
+	}
+	return limit, nil
+}
+
+// slice returns the records on the requested page; past the end it is
+// empty.
+func (p pageRequest) slice(records []map[string]any) []map[string]any {
+	start := (p.Page - 1) * p.Limit
+	if start >= len(records) {
+		return []map[string]any{}
+	}
+	end := start + p.Limit
+	if end > len(records) {
+		end = len(records)
+	}
+	return records[start:end]
+}
+
+// lastPage is the number of the last page for total records; at least 1.
+func (p pageRequest) lastPage(total int) int {
+	if last := (total + p.Limit - 1) / p.Limit; last > 1 {
+		return last
+	}
+	return 1
+}
+
+// links builds an RFC 5988 Link header for the page: first and last always,
+// prev and next unless the page is at that boundary. URLs keep the
+// request's other query parameters.
+func (p pageRequest) links(c *fiber.Ctx, total int) string {
+	last := p.lastPage(total)
+
+	link := func(page int, rel string) string {
+		args := fasthttp.AcquireArgs()
+		defer fasthttp.ReleaseArgs(args)
+		c.Request().URI().QueryArgs().CopyTo(args)
+		args.Set(queryPage, strconv.Itoa(page))
+		args.Set(queryLimit, strconv.Itoa(p.Limit))
+		return fmt.Sprintf(`<%s%s?%s>; rel="%s"`, c.BaseURL(), c.Path(), args.String(), rel)
+	}
+
+	parts := []string{link(1, "first")}
+	if p.Page > 1 {
+		parts = append(parts, link(p.Page-1, "prev"))
+	}
+	if p.Page < last {
+		parts = append(parts, link(p.Page+1, "next"))
+	}
+	parts = append(parts, link(last, "last"))
+	return strings.Join(parts, ", ")
+}
+
+// cursorPage is a parsed cursor request. The cursor is the base64 of the
+// last id the client has seen; an empty one starts from the beginning.
+type cursorPage struct {
+	After int // 0 for the first page
+	Limit int
+}
+
+// parseCursor reads cursor and _limit from a collection request.
+func parseCursor(c *fiber.Ctx, opts *Options) (p cursorPage, err error) {
+	if raw := c.Query(queryCursor); raw != "" {
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(raw, "="))
+		if err != nil {
+			return p, fmt.Errorf("invalid %s", queryCursor)
+		}
+		if p.After, err = strconv.Atoi(string(b)); err != nil || p.After < 1 {
+			return p, fmt.Errorf("invalid %s", queryCursor)
+		}
+	}
+	p.Limit, err = pageLimit(c, opts)
+	return p, err
+}
+
+// encodeCursor is the cursor pointing after the record with id.
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+// slice returns the records after the cursor and the cursor for the page
+// that follows, or nil on the last page. If the cursor's record is gone,
+// the page starts at the first record with a larger id.
+func (p cursorPage) slice(records []map[string]any) ([]map[string]any, any) {
+	start := 0
+	if p.After > 0 {
+		start = len(records)
+		for i, record := range records {
+			if id := recordID(record); id == p.After {
+				start = i + 1
+				break
+			} else if id > p.After && i < start {
+				start = i
+			}
+		}
+	}
+
+	end := start + p.Limit
+	if end >= len(records) {
+		return records[start:], nil
+	}
+	return records[start:end], encodeCursor(recordID(records[end-1]))
+}
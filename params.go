@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// isArrayParam reports whether a parameter is declared with an array schema.
+func isArrayParam(p *openapi3.Parameter) bool {
+	return p.Schema != nil && p.Schema.Value != nil && p.Schema.Value.Type == "array"
+}
+
+// queryArray collects the items of an array query parameter according to
+// its style and explode settings: ?tag=a&tag=b for exploded form (the
+// default), ?tag=a,b for form with explode: false, and ?tag=a|b or
+// ?tag=a%20b for pipeDelimited and spaceDelimited. present is false when
+// the parameter wasn't sent.
+func queryArray(c *fiber.Ctx, p *openapi3.Parameter) (items []string, present bool) {
+	raw := c.Context().QueryArgs().PeekMulti(p.Name)
+	if len(raw) == 0 {
+		return nil, false
+	}
+
+	// explode defaults to true for form only. kin-openapi's
+	// SerializationMethod defaults it to true for every query style, so
+	// it isn't used here.
+	style := p.Style
+	if style == "" {
+		style = openapi3.SerializationForm
+	}
+	explode := style == openapi3.SerializationForm
+	if p.Explode != nil {
+		explode = *p.Explode
+	}
+
+	sep := ","
+	switch style {
+	case openapi3.SerializationSpaceDelimited:
+		sep = " "
+	case openapi3.SerializationPipeDelimited:
+		sep = "|"
+	}
+	for _, v := range raw {
+		if explode {
+			items = append(items, string(v))
+		} else {
+			items = append(items, strings.Split(string(v), sep)...)
+		}
+	}
+	return items, true
+}
+
+// checkQueryArray validates an array query parameter's items against its
+// item schema. An empty value such as ?tag= is only accepted with
+// allowEmptyValue.
+func checkQueryArray(c *fiber.Ctx, p *openapi3.Parameter) []string {
+	items, present := queryArray(c, p)
+	if !present {
+		return nil
+	}
+	if len(items) == 1 && items[0] == "" {
+		if p.AllowEmptyValue {
+			return nil
+		}
+		return []string{fmt.Sprintf("Query parameter \"%s\" must not be empty", p.Name)}
+	}
+
+	schema := p.Schema.Value
+	values := make([]any, len(items))
+	var violations []string
+	for i, item := range items {
+		values[i] = item
+		if schema.Items == nil || schema.Items.Value == nil {
+			continue
+		}
+		values[i] = coerceString(item, schema.Items.Value)
+		if err := checkType(fmt.Sprintf("%s[%d]", p.Name, i), values[i], schema.Items.Value); err != nil {
+			violations = append(violations, queryViolation(err))
+		}
+	}
+	if err := checkType(p.Name, values, schema); err != nil {
+		violations = append(violations, queryViolation(err))
+	}
+	if schema.MaxItems != nil && uint64(len(items)) > *schema.MaxItems {
+		violations = append(violations, fmt.Sprintf("Query parameter \"%s\" must have at most %d items", p.Name, *schema.MaxItems))
+	}
+	return violations
+}
+
+// coerceString converts a string from a query, cookie or (with
+// --coerce-types) a JSON body to the JSON type its schema declares, so
+// checkType can judge it. Values that don't convert stay strings and fail
+// the type check.
+func coerceString(s string, schema *openapi3.Schema) any {
+	switch schema.Type {
+	case "integer":
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return float64(n)
+		}
+	case "number":
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return s
+}
+
+// queryViolation rewords a checkType error for a query parameter.
+func queryViolation(err error) string {
+	return strings.Replace(err.Error(), "Property", "Query parameter", 1)
+}
+
+// checkCookieParam validates a cookie parameter's value against its
+// schema. Cookies that weren't sent are left to the required check.
+func checkCookieParam(c *fiber.Ctx, p *openapi3.Parameter) []string {
+	val := c.Cookies(p.Name)
+	if val == "" || p.Schema == nil || p.Schema.Value == nil {
+		return nil
+	}
+	if err := checkType(p.Name, coerceString(val, p.Schema.Value), p.Schema.Value); err != nil {
+		return []string{strings.Replace(err.Error(), "Property", "Cookie parameter", 1)}
+	}
+	return nil
+}
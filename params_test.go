@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCookieParams(t *testing.T) {
+	spec := strings.Replace(testSpec, `  /users:
+    get:
+      responses:`, `  /users:
+    get:
+      parameters:
+        - {name: session, in: cookie, required: true, schema: {type: string}}
+        - {name: pageSize, in: cookie, schema: {type: integer}}
+        - {name: theme, in: cookie, schema: {type: string, enum: [dark, light]}}
+      responses:`, 1)
+	app := newTestApp(t, spec, `{"users": [{"id": 1, "name": "Ann"}]}`, nil)
+
+	tests := []struct {
+		name, cookie string
+		status       int
+		message      string
+	}{
+		{"present", "session=abc", 200, ""},
+		{"present with a valid optional cookie", "session=abc; pageSize=20", 200, ""},
+		{"absent", "", 400, `Required cookie parameter "session" is missing`},
+		{"only another cookie", "pageSize=20", 400, `Required cookie parameter "session" is missing`},
+		{"not an integer", "session=abc; pageSize=lots", 400, `Cookie parameter "pageSize" must be a number`},
+		{"not in the enum", "session=abc; theme=pink", 400, `Cookie parameter "theme" must be one of: [dark light]`},
+	}
+	for _, tt := range tests {
+		var headers []string
+		if tt.cookie != "" {
+			headers = []string{"Cookie", tt.cookie}
+		}
+		resp, body := send(t, app, "GET", "/users", "", headers...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: got %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+			continue
+		}
+		if tt.message == "" {
+			continue
+		}
+		if got := decode[map[string]any](t, body)["message"]; got != tt.message {
+			t.Errorf("%s: message %q, want %q", tt.name, got, tt.message)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// parseRange reads a single-range "bytes=first-last" Range header against a
+// body of size bytes and returns the inclusive slice bounds. "bytes=100-"
+// runs to the end and "bytes=-100" is the last 100 bytes. ok is false for
+// headers this mock doesn't serve partially, such as multiple ranges or
+// another unit; satisfiable is false when the range lies outside the body.
+func parseRange(header string, size int) (first, last int, ok, satisfiable bool) {
+	spec, found := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, false
+	}
+	from, to, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, false
+	}
+
+	if from == "" {
+		n, err := strconv.Atoi(to)
+		if err != nil || n < 0 {
+			return 0, 0, false, false
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, true, false
+		}
+		return max(size-n, 0), size - 1, true, true
+	}
+
+	first, err := strconv.Atoi(from)
+	if err != nil || first < 0 {
+		return 0, 0, false, false
+	}
+	last = size - 1
+	if to != "" {
+		if last, err = strconv.Atoi(to); err != nil || last < first {
+			return 0, 0, false, false
+		}
+	}
+	if first >= size {
+		return 0, 0, true, false
+	}
+	return first, min(last, size-1), true, true
+}
+
+// sendBytes writes data with status. A 200 answer to a GET honours a
+// single byte Range with 206 Partial Content and a Content-Range header,
+// or 416 when the range lies outside the body.
+func sendBytes(c *fiber.Ctx, status int, data []byte) error {
+	if status != fiber.StatusOK || c.Method() != fiber.MethodGet {
+		return c.Status(status).Send(data)
+	}
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+
+	header := c.Get(fiber.HeaderRange)
+	if header == "" {
+		return c.Status(status).Send(data)
+	}
+	first, last, ok, satisfiable := parseRange(header, len(data))
+	if !ok {
+		return c.Status(status).Send(data)
+	}
+	if !satisfiable {
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", len(data)))
+		return writeError(c, fiber.StatusRequestedRangeNotSatisfiable,
+			fmt.Sprintf("Range %s is outside the %d-byte body", header, len(data)))
+	}
+	c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", first, last, len(data)))
+	return c.Status(fiber.StatusPartialContent).Send(data[first : last+1])
+}
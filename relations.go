@@ -0,0 +1,150 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// Relations between resources follow json-server's foreign-key convention:
+// a comment belongs to a post when it has a "postId" field holding the
+// post's id. ?_embed=comments on /posts attaches each post's comments, and
+// ?_expand=post on /comments inlines each comment's post.
+
+// relations is what a GET asked to attach through _embed and _expand.
+type relations struct {
+	embed  []string // child collections, e.g. "comments"
+	expand []string // parent names in the singular, e.g. "post"
+}
+
+// parseRelations reads comma-separated or repeated _embed and _expand
+// parameters.
+func parseRelations(args func(key string) []string) relations {
+	return relations{embed: splitArgs(args("_embed")), expand: splitArgs(args("_expand"))}
+}
+
+func splitArgs(values []string) []string {
+	var out []string
+	for _, v := range values {
+		out = append(out, splitList(v)...)
+	}
+	return out
+}
+
+func (r relations) empty() bool {
+	return len(r.embed) == 0 && len(r.expand) == 0
+}
+
+// collections lists the other collections the relations read from.
+func (r relations) collections() []string {
+	names := append([]string{}, r.embed...)
+	for _, name := range r.expand {
+		names = append(names, pluralize(name))
+	}
+	return names
+}
+
+// foreignKey is the field a child of resource uses to point at it.
+func foreignKey(resource string) string {
+	return singularize(resource) + "Id"
+}
+
+// resolve returns copies of records with the requested relations attached.
+// The stored records are never modified. Callers must hold read locks on
+// every collection named by r.collections.
+func (r relations) resolve(store *Store, resource string, records []map[string]any) []map[string]any {
+	out := make([]map[string]any, len(records))
+	for i, record := range records {
+		cp := make(map[string]any, len(record)+len(r.embed)+len(r.expand))
+		for k, v := range record {
+			cp[k] = v
+		}
+		out[i] = cp
+	}
+
+	fk := foreignKey(resource)
+	for _, child := range r.embed {
+		col := store.Lookup(child)
+		byParent := map[int][]map[string]any{}
+		if col != nil {
+			for _, rec := range col.Records {
+				if id := toID(rec[fk]); id != 0 {
+					byParent[id] = append(byParent[id], rec)
+				}
+			}
+		}
+		for _, rec := range out {
+			children := byParent[recordID(rec)]
+			if children == nil {
+				children = []map[string]any{}
+			}
+			rec[child] = children
+		}
+	}
+
+	for _, parent := range r.expand {
+		col := store.Lookup(pluralize(parent))
+		if col == nil {
+			continue
+		}
+		for _, rec := range out {
+			if _, p := col.Find(toID(rec[parent+"Id"])); p != nil {
+				rec[parent] = p
+			}
+		}
+	}
+	return out
+}
+
+// rlockCollections read-locks the named collections that exist, in name
+// order, and returns the matching unlock. Writers only ever hold one
+// collection lock, so a fixed order is enough to rule out deadlocks
+// between readers.
+func (s *Store) rlockCollections(names []string) func() {
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+
+	var locked []*Collection
+	seen := map[string]bool{}
+	for _, name := range sorted {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if col := s.Lookup(name); col != nil {
+			col.RLock()
+			locked = append(locked, col)
+		}
+	}
+	return func() {
+		for _, col := range locked {
+			col.RUnlock()
+		}
+	}
+}
+
+// pluralize turns a singular resource name into its collection name:
+// post → posts, category → categories, box → boxes.
+func pluralize(name string) string {
+	switch {
+	case strings.HasSuffix(name, "y") && len(name) > 1 && !strings.ContainsRune("aeiou", rune(name[len(name)-2])):
+		return name[:len(name)-1] + "ies"
+	case strings.HasSuffix(name, "s"), strings.HasSuffix(name, "x"),
+		strings.HasSuffix(name, "ch"), strings.HasSuffix(name, "sh"):
+		return name + "es"
+	}
+	return name + "s"
+}
+
+// singularize undoes pluralize for the common English endings.
+func singularize(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "xes"),
+		strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"):
+		return strings.TrimSuffix(name, "es")
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss"):
+		return strings.TrimSuffix(name, "s")
+	}
+	return name
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Error body shapes selectable with --error-format.
+const (
+	ErrorFormatDefault = "default" // {"error": "...", "message": "..."}
+	ErrorFormatProblem = "problem" // RFC 7807 application/problem+json
+)
+
+// Response envelopes selectable with --envelope.
+const (
+	EnvelopeNone        = "none"        // bare arrays and objects
+	EnvelopeCollections = "collections" // {"data": [...], "meta": {...}} for collections
+	EnvelopeAll         = "all"         // collections as above, records as {"data": {...}}
+)
+
+// errorFormat is the shape used for every error body. Set from --error-format.
+var errorFormat = ErrorFormatDefault
+
+// ParseErrorFormat validates an --error-format value.
+func ParseErrorFormat(s string) (string, error) {
+	switch s {
+	case "", ErrorFormatDefault:
+		return ErrorFormatDefault, nil
+	case ErrorFormatProblem:
+		return ErrorFormatProblem, nil
+	}
+	return "", fmt.Errorf("unknown error format %q (want default or problem)", s)
+}
+
+// writeError sends an error body in the configured shape.
+func writeError(c *fiber.Ctx, statusCode int, message string) error {
+	if errorFormat == ErrorFormatProblem {
+		c.Status(statusCode)
+		if err := c.JSON(fiber.Map{
+			"type":   "about:blank",
+			"title":  http.StatusText(statusCode),
+			"status": statusCode,
+			"detail": message,
+		}); err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, "application/problem+json")
+		return nil
+	}
+	return c.Status(statusCode).JSON(fiber.Map{
+		"error":   http.StatusText(statusCode),
+		"message": message,
+	})
+}
+
+// writeJSONArray streams records as a JSON array, encoding each one only as
+// the stream reaches it, so memory stays flat however large the collection.
+// The stream is written after the handler has returned and dropped its
+// locks, so each record is encoded under rlock, which takes them again.
+// Headers must be set before calling it.
+func writeJSONArray(c *fiber.Ctx, status int, records []map[string]any, rlock func() (unlock func())) error {
+	// The caller's slice may share the collection's backing array, which a
+	// DELETE shifts in place.
+	records = append([]map[string]any(nil), records...)
+
+	c.Status(status)
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		_ = w.WriteByte('[')
+		for i, record := range records {
+			if i > 0 {
+				_ = w.WriteByte(',')
+			}
+			unlock := rlock()
+			b, err := json.Marshal(record)
+			unlock()
+			if err != nil {
+				return
+			}
+			if _, err := w.Write(b); err != nil {
+				return // the client went away
+			}
+		}
+		_ = w.WriteByte(']')
+	})
+	return nil
+}
+
+// mimeNDJSON is newline-delimited JSON: one record per line. Collections
+// are streamed in it to clients that ask for it.
+const mimeNDJSON = "application/x-ndjson"
+
+// writeNDJSON streams records one per line, flushing after each, so a
+// client tailing the response sees them as they are written. The records
+// are encoded up front because the stream is written after the handler
+// has returned and the collection lock is gone.
+func writeNDJSON(c *fiber.Ctx, status int, records []map[string]any) error {
+	lines := make([][]byte, len(records))
+	for i, record := range records {
+		b, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		lines[i] = b
+	}
+
+	c.Status(status)
+	c.Set(fiber.HeaderContentType, mimeNDJSON)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		for _, line := range lines {
+			_, _ = w.Write(line)
+			_ = w.WriteByte('\n')
+			if err := w.Flush(); err != nil {
+				return // the client went away
+			}
+		}
+	})
+	return nil
+}
+
+// wantsNDJSON reports whether Accept picks application/x-ndjson from the
+// media types the operation's response for status declares.
+func wantsNDJSON(c *fiber.Ctx, op *openapi3.Operation, status int) bool {
+	resp, ok := declaredResponse(op, status)
+	if !ok {
+		return false
+	}
+	ct, ok := responseContentType(resp, c.Get(fiber.HeaderAccept))
+	return ok && parseMediaType(ct) == parseMediaType(mimeNDJSON)
+}
+
+// notFoundHandler is mounted after every other route and answers anything
+// left unmatched with a JSON 404.
+func notFoundHandler(c *fiber.Ctx) error {
+	logger := NewLogger(requestID(c))
+	logger.RequestReceived(c.Method(), c.Path())
+	logger.Warning(ComponentHTTPServer, "No route matches this request")
+	logger.RespondWith(404)
+	return writeError(c, 404, fmt.Sprintf("Cannot %s %s", c.Method(), c.Path()))
+}
@@ -1,58 +1,344 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"regexp"
 	"sort"
 	"strings"
 	"github.com/gofiber/fiber/v2"
 	"github.com/getkin/kin-openapi/openapi3"
 )
 
-func RegisterRoutes(app *fiber.App, doc *openapi3.T, store *Store, dataFile string) {
-	endpointsMap := map[string]struct{}{}
+func RegisterRoutes(app *fiber.App, doc *openapi3.T, store *Store, opts *Options) {
+	registerCannedRoutes(app, opts.Routes, Endpoints(doc), opts.CaseInsensitive)
 
 	for path, item := range doc.Paths {
 		p := path
-		resource := strings.Split(strings.Trim(p, "/"), "/")[0]
+		allowed := routeMethods(item)
+		for _, m := range allowed {
+			method := m
+			// Resolved once here rather than looked up on every request.
+			op := item.GetOperation(operationMethod(method))
+			route, _ := resourceOf(p, item, op)
+			store.Collection(route.Name)
+			// Operation-level parameters come first so they win lookups.
+			params := item.Parameters
+			if op != nil {
+				params = append(append(openapi3.Parameters{}, op.Parameters...), item.Parameters...)
+				warmConstraints(op)
+			}
+			app.Add(method, fiberPath(p, params, opts.CaseInsensitive), func(c *fiber.Ctx) error {
+				return handle(c, method, p, route, op, store, opts)
+			})
+			routeTable = append(routeTable, describeRoute(method, p, route, op, opts))
+		}
+
+		// Bare OPTIONS lists what the path supports. CORS preflights are
+		// answered earlier by the CORS middleware and never get here.
+		allow := strings.Join(append(allowed, fiber.MethodOptions), ", ")
+		app.Options(fiberPath(p, item.Parameters, opts.CaseInsensitive), func(c *fiber.Ctx) error {
+			logger := NewLogger(requestID(c))
+			logger.RequestReceived(fiber.MethodOptions, c.Path())
+			logger.RespondWith(fiber.StatusNoContent)
+			c.Set(fiber.HeaderAllow, allow)
+			return c.SendStatus(fiber.StatusNoContent)
+		})
+	}
 
-		if store.Data[resource] == nil {
-			store.Data[resource] = []map[string]any{}
+	sort.SliceStable(routeTable, func(i, j int) bool { return routeTable[i].Path < routeTable[j].Path })
+
+	if endpoints := Endpoints(doc); len(endpoints) > 0 {
+		log.Println("Available endpoints:")
+		for _, e := range endpoints {
+			log.Printf("  %s", e)
 		}
+	}
+}
 
-		register := func(method string) {
-			app.Add(method, p, func(c *fiber.Ctx) error {
-				return handle(c, method, resource, store, dataFile)
-			})
-			endpointsMap[strings.ToUpper(method)+" "+p] = struct{}{}
+// Endpoints returns the sorted "METHOD /path" list that RegisterRoutes
+// exposes for doc, without touching a fiber app.
+func Endpoints(doc *openapi3.T) []string {
+	endpointsMap := map[string]struct{}{}
+	for path, item := range doc.Paths {
+		for _, method := range routeMethods(item) {
+			endpointsMap[method+" "+path] = struct{}{}
+		}
+		endpointsMap[fiber.MethodOptions+" "+path] = struct{}{}
+	}
+
+	endpoints := make([]string, 0, len(endpointsMap))
+	for e := range endpointsMap {
+		endpoints = append(endpoints, e)
+	}
+	sort.Strings(endpoints)
+	return endpoints
+}
+
+// warmConstraints precomputes the body constraints of an operation's request
+// schemas so the first request doesn't pay for them.
+func warmConstraints(op *openapi3.Operation) {
+	if op.RequestBody == nil || op.RequestBody.Value == nil {
+		return
+	}
+	for _, mt := range op.RequestBody.Value.Content {
+		if mt != nil && mt.Schema != nil && mt.Schema.Value != nil {
+			constraintsFor(mt.Schema.Value)
+		}
+	}
+}
+
+// routeMethods lists the methods served for a path item, in registration
+// order. Every GET also gets a HEAD.
+func routeMethods(item *openapi3.PathItem) []string {
+	var methods []string
+	if item.Get != nil {
+		methods = append(methods, fiber.MethodGet, fiber.MethodHead)
+	}
+	if item.Post != nil {
+		methods = append(methods, fiber.MethodPost)
+	}
+	if item.Put != nil {
+		methods = append(methods, fiber.MethodPut)
+	}
+	if item.Patch != nil {
+		methods = append(methods, fiber.MethodPatch)
+	}
+	if item.Delete != nil {
+		methods = append(methods, fiber.MethodDelete)
+	}
+	// TRACE has no store behaviour; handle answers it with 501 unless a
+	// scenario or mock extension does.
+	if item.Trace != nil {
+		methods = append(methods, fiber.MethodTrace)
+	}
+	return methods
+}
+
+// fiberPath rewrites OpenAPI path templates ("/users/{id}") into fiber's
+// route syntax ("/users/:id"). Path parameters whose schema is an integer,
+// number, boolean, uuid or has a pattern get the matching fiber constraint,
+// so requests that don't fit fall through to the 404 handler.
+func fiberPath(specPath string, params openapi3.Parameters, caseInsensitive bool) string {
+	segments := strings.Split(specPath, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			name := strings.TrimSuffix(strings.TrimPrefix(seg, "{"), "}")
+			segments[i] = ":" + name + paramConstraint(specPath, params.GetByInAndName("path", name), caseInsensitive)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// paramConstraint derives a fiber route constraint from a path parameter's
+// schema, or "" when there is nothing to enforce.
+//
+// Case-insensitive routing makes fiber lowercase the whole route, regex
+// included, so patterns are then matched with (?i).
+func paramConstraint(specPath string, p *openapi3.Parameter, caseInsensitive bool) string {
+	if p == nil || p.Schema == nil || p.Schema.Value == nil {
+		return ""
+	}
+	schema := p.Schema.Value
+
+	if schema.Pattern != "" {
+		if fiberSafePattern(schema.Pattern) {
+			if caseInsensitive {
+				return "<regex((?i)" + schema.Pattern + ")>"
+			}
+			return "<regex(" + schema.Pattern + ")>"
+		}
+		key := specPath + " " + p.Name
+		if !unenforcedPatterns[key] {
+			unenforcedPatterns[key] = true
+			log.Printf("⚠️  %s: pattern %q for path parameter %q can't be expressed as a route constraint; not enforced",
+				specPath, schema.Pattern, p.Name)
 		}
+	}
+
+	switch {
+	case schema.Type == "integer":
+		return "<int>"
+	case schema.Type == "number":
+		return "<float>"
+	case schema.Type == "boolean":
+		return "<bool>"
+	case schema.Type == "string" && schema.Format == "uuid":
+		return "<guid>"
+	}
+	return ""
+}
+
+// unenforcedPatterns remembers which pattern warnings were already printed,
+// since a path is registered once per method.
+var unenforcedPatterns = map[string]bool{}
+
+// upperEscape matches escapes such as \D or \W that would change meaning if
+// fiber lowercased them.
+var upperEscape = regexp.MustCompile(`\\[A-Z]`)
+
+// fiberSafePattern reports whether a regex can be embedded in fiber's
+// <regex(...)> syntax: fiber splits constraints on ';', ends them at '>',
+// lowercases routes when case-insensitive, and panics on patterns that don't
+// compile.
+func fiberSafePattern(pattern string) bool {
+	if strings.ContainsAny(pattern, ";<>/") || upperEscape.MatchString(pattern) {
+		return false
+	}
+	_, err := regexp.Compile(pattern)
+	return err == nil
+}
+
+// operationMethod maps a registered method onto the spec operation serving
+// it; HEAD is answered by the GET operation.
+func operationMethod(method string) string {
+	if method == fiber.MethodHead {
+		return fiber.MethodGet
+	}
+	return method
+}
+
+// routeResource is how a spec path maps onto the store.
+type routeResource struct {
+	Name        string // collection serving the path, e.g. "settings"
+	ItemParam   string // path parameter holding the record id; "" on a collection path
+	Parent      string // collection the path is nested under, e.g. "users"
+	ParentParam string // path parameter holding the parent record's id
+}
+
+// resourceFor maps a spec path onto the store. Literal segments name
+// collections and a parameter after one picks a record in it, so
+// /users/{id}/settings is the settings collection scoped to one user, and
+// /users/{userId}/settings/{id} is one of those settings. A path that doesn't
+// alternate like this falls back to its first segment, and err says why.
+func resourceFor(path string) (routeResource, error) {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	paramName := func(seg string) (string, bool) {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			return seg[1 : len(seg)-1], true
+		}
+		return "", false
+	}
 
-		if item.Get != nil {
-			register(fiber.MethodGet)
+	var r routeResource
+	var err error
+	for _, seg := range segs {
+		if name, ok := paramName(seg); ok {
+			if r.Name == "" || r.ItemParam != "" {
+				err = fmt.Errorf("%s does not follow a collection segment", seg)
+				break
+			}
+			r.ItemParam = name
+			continue
 		}
-		if item.Post != nil {
-			register(fiber.MethodPost)
+		if seg == "" {
+			err = errors.New("there is no collection segment")
+			break
 		}
-		if item.Put != nil {
-			register(fiber.MethodPut)
+		if r.Name != "" && r.ItemParam == "" {
+			err = fmt.Errorf("%s follows the %s collection instead of an id parameter", seg, r.Name)
+			break
 		}
-		if item.Patch != nil {
-			register(fiber.MethodPatch)
+		if r.Name != "" {
+			r.Parent, r.ParentParam = r.Name, r.ItemParam
 		}
-		if item.Delete != nil {
-			register(fiber.MethodDelete)
+		r.Name, r.ItemParam = seg, ""
+	}
+	if err == nil {
+		return r, nil
+	}
+
+	r = routeResource{Name: segs[0]}
+	if strings.Contains(path, "{id}") {
+		r.ItemParam = "id"
+	}
+	return r, err
+}
+
+// resourceOf is resourceFor with the collection named by x-mock-resource,
+// taken from the operation or else its path item, e.g. "users" for
+// /api/v1/users/{id}. A path that doesn't alternate then serves the named
+// collection, with its last segment as the id when that is a parameter.
+func resourceOf(path string, item *openapi3.PathItem, op *openapi3.Operation) (routeResource, error) {
+	route, err := resourceFor(path)
+	name := ""
+	if op != nil {
+		name, _ = op.Extensions[extResource].(string)
+	}
+	if name == "" && item != nil {
+		name, _ = item.Extensions[extResource].(string)
+	}
+	if name == "" {
+		return route, err
+	}
+
+	if err != nil {
+		route = routeResource{}
+		segs := strings.Split(strings.Trim(path, "/"), "/")
+		if last := segs[len(segs)-1]; strings.HasPrefix(last, "{") && strings.HasSuffix(last, "}") {
+			route.ItemParam = last[1 : len(last)-1]
 		}
+	}
+	route.Name = name
+	return route, nil
+}
 
+// warnNonCRUDRoutes logs the spec routes whose shape doesn't fit the store's
+// /collection and /collection/{id} model. They still work, but only through
+// examples, templates, sequences or scenarios.
+func warnNonCRUDRoutes(doc *openapi3.T, opts *Options) {
+	var warnings []string
+	for path, item := range doc.Paths {
+		for method, op := range item.Operations() {
+			if status, _ := mockSequence(op); status != 0 {
+				continue
+			}
+			if status, _, _ := mockTemplate(op); status != 0 {
+				continue
+			}
+			if _, echo := mockEcho(op); echo && method == fiber.MethodPost {
+				continue
+			}
+			params := op.Parameters
+			params = append(params[:len(params):len(params)], item.Parameters...)
+			if problem := crudShapeProblem(method, path, item, op, params, opts); problem != "" {
+				warnings = append(warnings, method+" "+path+": "+problem)
+			}
+		}
+	}
+	sort.Strings(warnings)
+	for _, w := range warnings {
+		log.Printf("⚠️  %s; it will only answer from examples, templates or scenarios", w)
 	}
+}
 
-	if len(endpointsMap) > 0 {
-		var endpoints []string
-		for e := range endpointsMap {
-			endpoints = append(endpoints, e)
+// crudShapeProblem explains why method on path doesn't map onto a store
+// collection, or returns "" when it does.
+func crudShapeProblem(method, path string, item *openapi3.PathItem, op *openapi3.Operation, params openapi3.Parameters, opts *Options) string {
+	route, err := resourceOf(path, item, op)
+	switch {
+	case method == fiber.MethodTrace:
+		return "TRACE has no store behaviour and answers 501"
+	case err != nil:
+		return err.Error()
+	case route.ItemParam != "" && method == fiber.MethodPost:
+		return "POST creates records on the collection path, not an item path"
+	case route.ItemParam == "" && (method == fiber.MethodPut || method == fiber.MethodPatch || method == fiber.MethodDelete):
+		return method + " needs an item path such as " + path + "/{id}"
+	case route.ItemParam != "":
+		if p := params.GetByInAndName("path", route.ItemParam); p != nil && p.Schema != nil && p.Schema.Value != nil {
+			if t := p.Schema.Value.Type; t != "" && t != "integer" {
+				return fmt.Sprintf("records have integer ids, but {%s} is a %s", route.ItemParam, t)
+			}
 		}
-		sort.Strings(endpoints)
-		log.Println("Available endpoints:")
-		for _, e := range endpoints {
-			log.Printf("  %s", e)
+	case method == fiber.MethodGet && opts.Envelope == EnvelopeNone && opts.Pagination == PaginationPage:
+		// A collection answers with an array; an object schema (e.g. a
+		// health check) means the path isn't really a collection.
+		_, resp, _ := successResponse(op)
+		if _, schema, ok := responseSchema(resp, ""); ok && schema.Type == "object" {
+			return "the response is an object, not a collection"
 		}
 	}
+	return ""
 }
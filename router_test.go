@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResourceForTwoLevelPaths(t *testing.T) {
+	tests := []struct {
+		path string
+		want routeResource
+	}{
+		{"/users", routeResource{Name: "users"}},
+		{"/users/{id}", routeResource{Name: "users", ItemParam: "id"}},
+		{"/users/{userId}/settings", routeResource{Name: "settings", Parent: "users", ParentParam: "userId"}},
+		{"/users/{userId}/settings/{id}", routeResource{Name: "settings", ItemParam: "id", Parent: "users", ParentParam: "userId"}},
+	}
+	for _, tt := range tests {
+		got, err := resourceFor(tt.path)
+		if err != nil || got != tt.want {
+			t.Errorf("resourceFor(%q) = %+v, %v, want %+v", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+// settingsSpec nests settings under users.
+const settingsSpec = `openapi: 3.0.3
+info: {title: test, version: "1"}
+paths:
+  /users/{userId}/settings:
+    parameters:
+      - {name: userId, in: path, required: true, schema: {type: integer}}
+    get:
+      responses:
+        "200": {description: ok}
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema: {type: object}
+      responses:
+        "201": {description: created, content: {application/json: {schema: {type: object}}}}
+  /users/{userId}/settings/{id}:
+    parameters:
+      - {name: userId, in: path, required: true, schema: {type: integer}}
+      - {name: id, in: path, required: true, schema: {type: integer}}
+    get:
+      responses:
+        "200": {description: ok}
+    delete:
+      responses:
+        "204": {description: deleted}
+`
+
+func TestNestedRoutes(t *testing.T) {
+	app := newTestApp(t, settingsSpec, `{"settings": [
+		{"id": 1, "userId": 1, "theme": "dark"},
+		{"id": 2, "userId": 2, "theme": "light"},
+		{"id": 3, "userId": 1, "theme": "blue"}
+	]}`, nil)
+
+	// The collection only lists the parent's records.
+	_, body := send(t, app, "GET", "/users/1/settings", "")
+	settings := decode[[]map[string]any](t, body)
+	if len(settings) != 2 || settings[0]["id"] != float64(1) || settings[1]["id"] != float64(3) {
+		t.Errorf("GET /users/1/settings: got %s", body)
+	}
+
+	if resp, body := send(t, app, "GET", "/users/1/settings/1", ""); resp.StatusCode != 200 || !strings.Contains(body, `"dark"`) {
+		t.Errorf("GET /users/1/settings/1: got %d %s", resp.StatusCode, body)
+	}
+	// Another user's setting is out of reach.
+	if resp, body := send(t, app, "GET", "/users/1/settings/2", ""); resp.StatusCode != 404 {
+		t.Errorf("GET /users/1/settings/2: got %d %s, want 404", resp.StatusCode, body)
+	}
+	if resp, body := send(t, app, "DELETE", "/users/1/settings/2", ""); resp.StatusCode != 404 {
+		t.Errorf("DELETE /users/1/settings/2: got %d %s, want 404", resp.StatusCode, body)
+	}
+
+	// POST ties the new record to the parent in the URL, whatever the body says.
+	resp, body := send(t, app, "POST", "/users/2/settings", `{"theme":"green","userId":1}`)
+	if resp.StatusCode != 201 {
+		t.Fatalf("POST /users/2/settings: got %d %s", resp.StatusCode, body)
+	}
+	created := decode[map[string]any](t, body)
+	if created["userId"] != float64(2) || created["id"] != float64(4) {
+		t.Errorf("POST /users/2/settings: created %s, want userId 2 and id 4", body)
+	}
+	if resp, _ := send(t, app, "GET", "/users/2/settings/4", ""); resp.StatusCode != 200 {
+		t.Errorf("GET /users/2/settings/4: got %d", resp.StatusCode)
+	}
+	if resp, _ := send(t, app, "GET", "/users/1/settings/4", ""); resp.StatusCode != 404 {
+		t.Errorf("GET /users/1/settings/4: got %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// parseRouteKey normalises a "METHOD /path" key from one of the route-keyed
+// config files. A bare operationId such as "createUser" is kept as it is
+// and resolved by resolveOperationIDs once the spec is loaded.
+func parseRouteKey(route string) (string, error) {
+	route = strings.TrimSpace(route)
+	if route != "" && !strings.ContainsAny(route, " /") {
+		return route, nil
+	}
+	method, path, ok := strings.Cut(route, " ")
+	path = strings.TrimSpace(path)
+	if !ok || !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("want \"METHOD /path\" or an operationId, got %q", route)
+	}
+	return strings.ToUpper(method) + " " + path, nil
+}
+
+// loadCannedRoutes reads a --routes file of static responses for endpoints
+// the spec doesn't describe, keyed by "METHOD /path" with the same entries
+// as a scenario:
+//
+//	GET /health: {status: 200, body: {ok: true}}
+//	GET /things/{id}: {status: 404}
+func loadCannedRoutes(file string) (map[string]scenario, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]scenario
+	if err := codecFor(file).unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	routes := make(map[string]scenario, len(raw))
+	for route, resp := range raw {
+		key, err := parseRouteKey(route)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		// Canned routes are outside the spec, so there is no operationId
+		// to resolve: the key has to name the method and path itself.
+		method, _, ok := strings.Cut(key, " ")
+		if !ok {
+			return nil, fmt.Errorf("%s: want \"METHOD /path\", got %q", file, route)
+		}
+		if !isFiberMethod(method) {
+			return nil, fmt.Errorf("%s: %s: unknown method %q", file, route, method)
+		}
+		if resp.Status == 0 {
+			resp.Status = fiber.StatusOK
+		}
+		if resp.Status < 100 || resp.Status > 599 {
+			return nil, fmt.Errorf("%s: %s: invalid status %d", file, route, resp.Status)
+		}
+		routes[key] = resp
+	}
+	return routes, nil
+}
+
+// isFiberMethod reports whether fiber can route method.
+func isFiberMethod(method string) bool {
+	for _, m := range fiber.DefaultMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// registerCannedRoutes mounts the --routes responses. They skip validation
+// and the store entirely. They are registered ahead of the spec's routes,
+// so one that collides with a spec route replaces it, with a warning.
+func registerCannedRoutes(app *fiber.App, routes map[string]scenario, specRoutes []string, caseInsensitive bool) {
+	if len(routes) == 0 {
+		return
+	}
+	known := map[string]bool{}
+	for _, e := range specRoutes {
+		known[e] = true
+	}
+
+	keys := make([]string, 0, len(routes))
+	for key := range routes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	log.Println("Canned routes:")
+	for _, key := range keys {
+		resp := routes[key]
+		method, path, _ := strings.Cut(key, " ")
+		if known[key] {
+			log.Printf("⚠️  --routes: %s is also in the spec; the canned response wins", key)
+		}
+		log.Printf("  %s", key)
+		routeTable = append(routeTable, routeInfo{Method: method, Path: path, Responses: []string{strconv.Itoa(resp.Status)}, Source: "routes"})
+
+		app.Add(method, fiberPath(path, nil, caseInsensitive), func(c *fiber.Ctx) error {
+			logger := NewLogger(requestID(c))
+			logger.RequestReceived(method, c.Path())
+			logger.Info(ComponentNegotiator, "Using the canned response from --routes")
+			logger.RespondWith(resp.Status)
+			return resp.send(c)
+		})
+	}
+}
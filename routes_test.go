@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadCannedRoutesRejectsUnroutableKeys(t *testing.T) {
+	tests := []struct {
+		routes, err string
+	}{
+		{`{"GET /health": {"status": 200}}`, ""},
+		{`{"health": {"status": 200}}`, `want "METHOD /path", got "health"`},
+		{`{"GTE /health": {"status": 200}}`, `GTE /health: unknown method "GTE"`},
+	}
+	for _, tt := range tests {
+		file := filepath.Join(t.TempDir(), "routes.json")
+		if err := os.WriteFile(file, []byte(tt.routes), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadCannedRoutes(file)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.routes, err)
+		case tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), file+": ") || !strings.HasSuffix(err.Error(), tt.err)):
+			t.Errorf("%s: got error %v, want %q", tt.routes, err, file+": "+tt.err)
+		}
+	}
+}
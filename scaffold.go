@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// runScaffoldData implements "mock-server scaffold-data <openapi.yaml>": it
+// writes a data file holding one example record per resource, as a starting
+// point for hand-edited fixtures.
+func runScaffoldData(openapiFile string, args []string) {
+	fs := flag.NewFlagSet("scaffold-data", flag.ExitOnError)
+	out := fs.String("o", "data.json", "file to write; .yaml or .yml writes YAML")
+	force := fs.Bool("force", false, "overwrite the file if it exists")
+	_ = fs.Parse(args)
+
+	if _, err := os.Stat(*out); err == nil && !*force {
+		log.Fatalf("%s already exists; pass --force to overwrite it", *out)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatal(err)
+	}
+
+	data := scaffoldData(loadSpec(openapiFile, &Options{}))
+	b, err := codecFor(*out).marshal(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, b, 0o644); err != nil {
+		log.Fatal(err)
+	}
+
+	filled := 0
+	for _, records := range data {
+		if len(records) > 0 {
+			filled++
+		}
+	}
+	log.Printf("📝 Wrote %s: %d resources, %d with an example record", *out, len(data), filled)
+}
+
+// scaffoldData builds a data file with every resource the spec exposes. Each
+// resource gets one record, taken from the first of these that has one:
+//
+//  1. the example of a GET on one record, e.g. GET /users/{id}
+//  2. the first item of the example of a GET on the collection
+//  3. the example of a POST body to the collection
+//  4. the property-level examples of the record schema
+//
+// Resources without any of these get an empty list. Records without an id
+// get id 1.
+func scaffoldData(doc *openapi3.T) map[string][]any {
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	data := map[string][]any{}
+	best := map[string]int{} // rank of the record found so far; lower wins
+	offer := func(resource string, rank int, record map[string]any) {
+		if record == nil {
+			return
+		}
+		if r, ok := best[resource]; ok && r <= rank {
+			return
+		}
+		if _, ok := record["id"]; !ok {
+			record["id"] = 1
+		}
+		best[resource] = rank
+		data[resource] = []any{record}
+	}
+
+	for _, path := range paths {
+		item := doc.Paths[path]
+		for _, op := range item.Operations() {
+			route, _ := resourceOf(path, item, op)
+			if _, ok := data[route.Name]; !ok {
+				data[route.Name] = []any{}
+			}
+		}
+
+		if op := item.Get; op != nil {
+			route, _ := resourceOf(path, item, op)
+			_, resp := operationResponse(op, 200)
+			mt := jsonMediaType(resp)
+			if route.ItemParam != "" {
+				if v, _, ok := mediaTypeExample(mt); ok {
+					offer(route.Name, 1, asRecord(v))
+				}
+				offer(route.Name, 4, propertyExamples(mediaTypeSchema(mt)))
+			} else {
+				if v, _, ok := mediaTypeExample(mt); ok {
+					if items, ok := v.([]any); ok && len(items) > 0 {
+						offer(route.Name, 2, asRecord(items[0]))
+					}
+				}
+				if schema := mediaTypeSchema(mt); schema != nil && schema.Items != nil {
+					offer(route.Name, 4, propertyExamples(schema.Items.Value))
+				}
+			}
+		}
+
+		if op := item.Post; op != nil && op.RequestBody != nil && op.RequestBody.Value != nil {
+			route, _ := resourceOf(path, item, op)
+			if route.ItemParam != "" {
+				continue
+			}
+			if _, mt, ok := lookupMediaType(op.RequestBody.Value.Content, "application/json"); ok {
+				if v, _, ok := mediaTypeExample(mt); ok {
+					offer(route.Name, 3, asRecord(v))
+				}
+				offer(route.Name, 4, propertyExamples(mediaTypeSchema(mt)))
+			}
+		}
+	}
+	return data
+}
+
+// jsonMediaType returns a response's JSON media type, or nil.
+func jsonMediaType(resp *openapi3.Response) *openapi3.MediaType {
+	if resp == nil {
+		return nil
+	}
+	for _, ct := range sortedContentTypes(resp.Content) {
+		if isJSONMediaType(ct) {
+			return resp.Content[ct]
+		}
+	}
+	return nil
+}
+
+// mediaTypeSchema returns a media type's schema, or nil.
+func mediaTypeSchema(mt *openapi3.MediaType) *openapi3.Schema {
+	if mt == nil || mt.Schema == nil {
+		return nil
+	}
+	return mt.Schema.Value
+}
+
+// asRecord returns a copy of v if it is a JSON object, so the spec's own
+// example isn't modified.
+func asRecord(v any) map[string]any {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil
+	}
+	record := make(map[string]any, len(obj))
+	for k, v := range obj {
+		record[k] = v
+	}
+	return record
+}
+
+// propertyExamples assembles a record from the examples of a schema's
+// properties, or returns nil when none has one.
+func propertyExamples(schema *openapi3.Schema) map[string]any {
+	if schema == nil {
+		return nil
+	}
+	_, props := collectSchemaConstraints(schema)
+	record := map[string]any{}
+	for name, prop := range props {
+		if prop.Example != nil {
+			record[name] = prop.Example
+		}
+	}
+	if len(record) == 0 {
+		return nil
+	}
+	return record
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// headerScenario selects a --scenarios response set for one request.
+const headerScenario = "X-Mock-Scenario"
+
+// scenario is a canned response from a --scenarios file.
+type scenario struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    any               `json:"body"`
+}
+
+// loadScenarios reads a --scenarios file mapping "METHOD /path" to named
+// scenarios, e.g.
+//
+//	GET /users:
+//	  empty: {status: 200, body: []}
+//	  error: {status: 500, body: {message: boom}}
+//
+// Paths are spec paths, as for --status. Status defaults to 200.
+func loadScenarios(file string) (map[string]map[string]scenario, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]map[string]scenario
+	if err := codecFor(file).unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	scenarios := make(map[string]map[string]scenario, len(raw))
+	for route, named := range raw {
+		key, err := parseRouteKey(route)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		for name, sc := range named {
+			if sc.Status == 0 {
+				sc.Status = fiber.StatusOK
+			}
+			if sc.Status < 100 || sc.Status > 599 {
+				return nil, fmt.Errorf("%s: %s scenario %q: invalid status %d", file, route, name, sc.Status)
+			}
+			named[name] = sc
+		}
+		scenarios[key] = named
+	}
+	return scenarios, nil
+}
+
+// routeScenario returns the scenario the request's X-Mock-Scenario header
+// names for a route, if any.
+func (o *Options) routeScenario(method, specPath, name string) (scenario, bool) {
+	if method == fiber.MethodHead {
+		method = fiber.MethodGet
+	}
+	sc, ok := o.Scenarios[method+" "+specPath][name]
+	return sc, ok
+}
+
+// send writes the scenario's response. String bodies go out as they are;
+// anything else is encoded as JSON. A Content-Type in the scenario's headers
+// wins over the default for either.
+func (sc scenario) send(c *fiber.Ctx) error {
+	c.Status(sc.Status)
+	contentType := ""
+	for k, v := range sc.Headers {
+		c.Set(k, v)
+		if strings.EqualFold(k, fiber.HeaderContentType) {
+			contentType = v
+		}
+	}
+	if sc.Body == nil {
+		return nil
+	}
+
+	body, isText := sc.Body.(string)
+	if !isText {
+		b, err := json.Marshal(sc.Body)
+		if err != nil {
+			return err
+		}
+		body = string(b)
+	}
+	if contentType == "" {
+		contentType = fiber.MIMEApplicationJSON
+		if isText {
+			contentType = fiber.MIMETextPlainCharsetUTF8
+		}
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.SendString(body)
+}
@@ -1,10 +1,20 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sort"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/getkin/kin-openapi/routers"
 	gorillamux "github.com/getkin/kin-openapi/routers/gorillamux"
@@ -13,32 +23,401 @@ import (
 var openapiDoc *openapi3.T
 var openapiRouter routers.Router
 
-func startServer(openapiPath, dataFile string, port int) {
+// operationIDs maps operationIds to their "METHOD /path" routes. Filled by
+// indexOperationIDs at startup.
+var operationIDs map[string]string
+
+// Options carries the command-line configuration through to the server and
+// request handlers.
+type Options struct {
+	Port     int
+	DataFile string
+	Metrics  bool
+
+	// DataOverlays are further --data files merged over DataFile at
+	// startup. Writes only ever go to DataFile.
+	DataOverlays []string
+	NoPersist    bool // --no-persist: keep every change in memory only
+
+	AccessLog     string // "", "common" or "combined"
+	AccessLogFile string // empty means stdout
+	Compress      bool
+	MaxBodySize   int // bytes; 0 keeps fiber's default
+
+	CaseInsensitive bool // match /Users like /users
+	ReadOnly        bool // reject POST/PUT/PATCH/DELETE with 405
+	ServerIDs       bool // reject a POST body carrying its own id with 400
+
+	RejectDeprecated bool // answer deprecated operations with 410
+	UseParamExamples bool // fill missing query parameters from their examples
+	RejectEmptyBody  bool // answer empty optional bodies with 400 instead of storing {}
+
+	AllowStatusOverride bool   // honour ?__status= for statuses the operation declares
+	StrictQuery         bool   // --strict-query: reject undeclared query parameters
+	CoerceTypes         bool   // --coerce-types: convert "30" to 30 in JSON bodies before validating
+	Validator           string // ValidatorBuiltin or ValidatorKin
+	ValidateResponses   bool   // --validate-responses: check JSON responses against the spec
+	InvalidResponses    string // InvalidResponsesWarn or InvalidResponsesFail
+
+	DefaultLimit  int    // page size when only _page is given; 0 means 10
+	MaxLimit      int    // cap on _limit; 0 means no cap
+	Pagination    string // PaginationPage or PaginationCursor
+	Envelope      string // EnvelopeNone, EnvelopeCollections or EnvelopeAll
+	CheckExamples bool   // validate spec examples against their schemas at startup
+	ExposeSpec    bool   // serve the loaded spec at /openapi.json and /openapi.yaml
+	DocsPath      string // serve Swagger UI here when set; implies ExposeSpec
+
+	SkipSpecValidation bool // log spec validation errors instead of exiting
+
+	// Success status overrides for the CRUD branches. MethodStatus is keyed
+	// by method ("POST"), RouteStatus by method and spec path
+	// ("POST /orders"); route entries win.
+	MethodStatus map[string]int
+	RouteStatus  map[string]int
+
+	// Timing delays responses per route, keyed like RouteStatus.
+	Timing map[string]time.Duration
+
+	// Latency delays every response a route's Timing doesn't cover, or
+	// LatencyDist samples that delay instead. DelayJitter spreads each
+	// delay uniformly over ±DelayJitter, and LatencyMax caps it when set.
+	Latency     time.Duration
+	LatencyDist *latencyDist
+	DelayJitter time.Duration
+	LatencyMax  time.Duration
+
+	// Throttle caps response bodies over 1KB at this many bytes per
+	// second; 0 means no cap.
+	Throttle int
+
+	// Scenarios holds --scenarios response sets, keyed like RouteStatus
+	// and then by X-Mock-Scenario name.
+	Scenarios map[string]map[string]scenario
+
+	// Routes are --routes static responses for endpoints outside the spec,
+	// keyed like RouteStatus.
+	Routes map[string]scenario
+
+	Admin bool
+
+	CORS            bool
+	CORSOrigins     []string // empty means any origin
+	CORSCredentials bool
+	CORSHeaders     string // empty reflects Access-Control-Request-Headers
+	CORSMaxAge      int    // seconds a preflight may be cached; 0 leaves it to the browser
+}
+
+func startServer(openapiPath string, opts *Options) {
+	doc := loadSpec(openapiPath, opts)
+	if opts.CheckExamples {
+		checkExamples(doc)
+	}
+	operationIDs = indexOperationIDs(doc)
+	resolveOperationIDs(opts.RouteStatus)
+	resolveOperationIDs(opts.Timing)
+	resolveOperationIDs(opts.Scenarios)
+	warnUnknownRoutes(doc, "--status", opts.RouteStatus)
+	warnUnknownRoutes(doc, "--timing", opts.Timing)
+	warnUnknownRoutes(doc, "--scenarios", opts.Scenarios)
+	warnNonCRUDRoutes(doc, opts)
+	openapiDoc = doc
+
+	r, err := gorillamux.NewRouter(routerDoc(doc))
+	if err != nil {
+		log.Fatalf("failed to create openapi router: %v", err)
+	}
+	openapiRouter = r
+
+	store := NewStore(opts.DataFile, opts.DataOverlays...)
+	store.inMemory = opts.NoPersist
+	app := NewApp(doc, store, opts)
+
+	log.Printf("🚀 Mock server running at http://localhost:%d", opts.Port)
+	log.Printf("📄 OpenAPI: %s", openapiPath)
+	if len(opts.DataOverlays) > 0 {
+		log.Printf("🗂️  Data: %s, overlaid with %s", opts.DataFile, strings.Join(opts.DataOverlays, ", "))
+	}
+	if opts.NoPersist {
+		log.Printf("💾 In memory only: changes are not written to %s", opts.DataFile)
+	}
+	if opts.Metrics {
+		log.Printf("📈 Metrics: http://localhost:%d%s", opts.Port, metricsPath)
+	}
+	if opts.ExposeSpec || opts.DocsPath != "" {
+		log.Printf("📜 Spec: http://localhost:%d%s", opts.Port, specJSONPath)
+	}
+	if opts.Latency > 0 || opts.LatencyDist != nil || opts.DelayJitter > 0 {
+		latency := opts.Latency.String()
+		if opts.LatencyDist != nil {
+			latency = opts.LatencyDist.String()
+		}
+		if opts.DelayJitter > 0 {
+			latency += " ± " + opts.DelayJitter.String()
+		}
+		if opts.LatencyMax > 0 {
+			latency += ", at most " + opts.LatencyMax.String()
+		}
+		log.Printf("🐢 Latency: %s", latency)
+	}
+	if opts.Throttle > 0 {
+		log.Printf("🐌 Throttle: %d bytes/s for bodies over %d bytes", opts.Throttle, throttleThreshold)
+	}
+	if len(opts.Timing) > 0 {
+		log.Printf("⏱️  Timing: %d route delays", len(opts.Timing))
+	}
+	if len(opts.Scenarios) > 0 {
+		log.Printf("🎬 Scenarios: %d routes (select with %s)", len(opts.Scenarios), headerScenario)
+	}
+	if opts.Validator == ValidatorKin {
+		log.Printf("🔎 Validating requests with kin-openapi")
+	}
+	if opts.ValidateResponses {
+		log.Printf("🔎 Validating responses against the spec (%s on a mismatch)", opts.InvalidResponses)
+	}
+	if opts.DocsPath != "" {
+		log.Printf("📚 Docs: http://localhost:%d%s", opts.Port, opts.DocsPath)
+	}
+
+	// Saves happen in the background; let the last ones reach the disk
+	// before exiting on Ctrl-C or SIGTERM.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-quit
+		_ = app.Shutdown()
+	}()
+
+	if err := app.Listen(":" + strconv.Itoa(opts.Port)); err != nil {
+		log.Fatal(err)
+	}
+	if err := store.Flush(); err != nil {
+		log.Printf("❌ Saving the store failed: %v", err)
+	}
+}
+
+// indexOperationIDs maps each operationId in doc to its "METHOD /path"
+// route. When two operations share an id, the first route in sorted order
+// keeps it and the clash is logged.
+func indexOperationIDs(doc *openapi3.T) map[string]string {
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	ids := map[string]string{}
+	for _, path := range paths {
+		ops := doc.Paths[path].Operations()
+		methods := make([]string, 0, len(ops))
+		for method := range ops {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			id := ops[method].OperationID
+			if id == "" {
+				continue
+			}
+			route := method + " " + path
+			if first, ok := ids[id]; ok {
+				log.Printf("⚠️  operationId %q is used by both %s and %s; it refers to %s", id, first, route, first)
+				continue
+			}
+			ids[id] = route
+		}
+	}
+	return ids
+}
+
+// resolveOperationIDs rewrites the operationId keys of a route-keyed option
+// into "METHOD /path" keys. Ids the spec doesn't declare are left alone for
+// warnUnknownRoutes to report.
+func resolveOperationIDs[V any](routes map[string]V) {
+	for key, v := range routes {
+		if strings.Contains(key, " ") {
+			continue
+		}
+		if route, ok := operationIDs[key]; ok {
+			delete(routes, key)
+			routes[route] = v
+		}
+	}
+}
+
+// warnUnknownRoutes logs the "METHOD /path" keys of a route-keyed option
+// that don't name a route the spec exposes.
+func warnUnknownRoutes[V any](doc *openapi3.T, flag string, routes map[string]V) {
+	known := map[string]bool{}
+	for _, e := range Endpoints(doc) {
+		known[e] = true
+	}
+	keys := make([]string, 0, len(routes))
+	for route := range routes {
+		keys = append(keys, route)
+	}
+	sort.Strings(keys)
+	for _, route := range keys {
+		if !known[route] {
+			log.Printf("⚠️  %s: %s is not a route in the spec; ignored", flag, route)
+		}
+	}
+}
+
+// loadSpec reads and validates the OpenAPI file, exiting on any error.
+func loadSpec(openapiPath string, opts *Options) *openapi3.T {
 	loader := openapi3.NewLoader()
-	doc, err := loader.LoadFromFile(openapiPath)
+	doc, err := loadDocument(loader, openapiPath)
 	if err != nil {
 		log.Fatalf("failed to load openapi: %v", err)
 	}
 
-	if err := doc.Validate(loader.Context); err != nil {
-		log.Fatalf("invalid openapi schema: %v", err)
+	// kin-openapi stops at the first bad example; --check-examples reports
+	// all of them instead, so leave examples to it.
+	validationOpts := []openapi3.ValidationOption{
+		openapi3.AllowExtraSiblingFields(keywordDependentRequired, keywordDependencies),
+	}
+	if opts.CheckExamples {
+		validationOpts = append(validationOpts, openapi3.DisableExamplesValidation())
+	}
+	// if/then/else and const are JSON Schema 2020-12, which only 3.1
+	// documents use.
+	if strings.HasPrefix(doc.OpenAPI, "3.1") {
+		validationOpts = append(validationOpts,
+			openapi3.AllowExtraSiblingFields(keywordIf, keywordThen, keywordElse, keywordConst))
 	}
 
-	openapiDoc = doc
+	if err := doc.Validate(loader.Context, validationOpts...); err != nil {
+		if !opts.SkipSpecValidation {
+			log.Fatalf("invalid openapi schema: %v", err)
+		}
+		log.Printf("🚧 --skip-spec-validation: serving an invalid spec; some routes may misbehave: %v", err)
+	}
 
-	r, err := gorillamux.NewRouter(doc)
-	if err != nil {
-		log.Fatalf("failed to create openapi router: %v", err)
+	if err := compileExtensions(doc); err != nil {
+		log.Fatalf("invalid spec extension: %v", err)
 	}
-	openapiRouter = r
 
-	store := NewStore(dataFile)
-	app := fiber.New()
+	return doc
+}
+
+// NewApp builds the fiber app: middleware first, then the built-in endpoints,
+// then the routes generated from the spec.
+func NewApp(doc *openapi3.T, store *Store, opts *Options) *fiber.App {
+	// Handlers resolve the operation and resource from the spec path bound
+	// at registration, so neither setting affects them.
+	app := fiber.New(fiber.Config{
+		BodyLimit:     opts.MaxBodySize,
+		ErrorHandler:  newErrorHandler(opts),
+		CaseSensitive: !opts.CaseInsensitive,
+		StrictRouting: false, // /users/ matches /users
+	})
 
-	RegisterRoutes(app, doc, store, dataFile)
+	if opts.AccessLog != "" {
+		w := os.Stdout
+		if opts.AccessLogFile != "" {
+			f, err := os.OpenFile(opts.AccessLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				log.Fatalf("failed to open access log: %v", err)
+			}
+			w = f
+		}
+		app.Use(accessLogMiddleware(opts.AccessLog, w))
+	}
 
-	log.Printf("🚀 Mock server running at http://localhost:%d", port)
-	log.Printf("📄 OpenAPI: %s", openapiPath)
+	if opts.CORS {
+		app.Use(corsMiddleware(opts))
+	}
+
+	// fasthttp leaves bodies under 200 bytes uncompressed, so small
+	// responses pass through untouched.
+	if opts.Compress {
+		app.Use(compress.New())
+	}
 
-	log.Fatal(app.Listen(":" + strconv.Itoa(port)))
+	// Registered ahead of the spec routes so it can't be shadowed by them.
+	if opts.Metrics {
+		metrics = NewMetrics()
+		app.Get(metricsPath, metricsHandler)
+	}
+
+	if opts.ExposeSpec || opts.DocsPath != "" {
+		registerSpecRoutes(app, doc)
+	}
+	if opts.DocsPath != "" {
+		registerDocsRoute(app, doc, opts.DocsPath)
+	}
+
+	if opts.Admin {
+		registerAdminRoutes(app, store, opts)
+	}
+
+	RegisterRoutes(app, doc, store, opts)
+
+	// Must come last: anything that reaches it matched no route.
+	app.Use(notFoundHandler)
+
+	return app
+}
+
+// newErrorHandler reports oversized bodies the same way validation failures
+// are reported. fasthttp rejects them before any route runs, so this is the
+// only place they surface. Any other error that escapes a handler is sent in
+// the configured error shape rather than fiber's plain text.
+func newErrorHandler(opts *Options) fiber.ErrorHandler {
+	return func(c *fiber.Ctx, err error) error {
+		var fe *fiber.Error
+		if errors.As(err, &fe) && fe.Code == fiber.StatusRequestEntityTooLarge {
+			logger := NewLogger(requestID(c))
+			logger.RequestReceived(c.Method(), c.Path())
+			return validationError(c, logger, fiber.StatusRequestEntityTooLarge,
+				fmt.Sprintf("Request body exceeds the maximum size of %d bytes", opts.MaxBodySize))
+		}
+		if fe != nil {
+			return writeError(c, fe.Code, fe.Message)
+		}
+		return writeError(c, fiber.StatusInternalServerError, err.Error())
+	}
+}
+
+// successStatus returns the status to send for a successful request,
+// honouring --<method>-status and --status overrides.
+func (o *Options) successStatus(method, specPath string, def int) int {
+	if method == fiber.MethodHead {
+		method = fiber.MethodGet
+	}
+	if code, ok := o.RouteStatus[method+" "+specPath]; ok {
+		return code
+	}
+	if code, ok := o.MethodStatus[method]; ok {
+		return code
+	}
+	return def
+}
+
+// routeDelay returns the delay for a route: its --timing entry or else
+// --latency or a --latency-dist sample, moved by up to --delay-jitter
+// either way, never below 0 and never above --latency-max. Randomness comes
+// from rng when it is set.
+func (o *Options) routeDelay(method, specPath string, rng *rand.Rand) time.Duration {
+	if method == fiber.MethodHead {
+		method = fiber.MethodGet
+	}
+	delay, ok := o.Timing[method+" "+specPath]
+	if !ok {
+		delay = o.Latency
+		if o.LatencyDist != nil {
+			delay = o.LatencyDist.sample(rng)
+		}
+	}
+	if o.DelayJitter > 0 {
+		int63n := rand.Int63n
+		if rng != nil {
+			int63n = rng.Int63n
+		}
+		delay += time.Duration(int63n(int64(2*o.DelayJitter)+1)) - o.DelayJitter
+	}
+	if o.LatencyMax > 0 {
+		delay = min(delay, o.LatencyMax)
+	}
+	return max(delay, 0)
 }
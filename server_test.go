@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	users := make([]map[string]any, 50)
+	for i := range users {
+		users[i] = map[string]any{"id": i + 1, "name": "user", "email": "user@example.com"}
+	}
+	data, _ := json.Marshal(map[string]any{"users": users})
+	app := newTestApp(t, testSpec, string(data), &Options{Compress: true})
+
+	_, plain := send(t, app, "GET", "/users", "")
+	resp, body := send(t, app, "GET", "/users", "", "Accept-Encoding", "gzip")
+	if got := resp.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("large body: Content-Encoding = %q, want gzip", got)
+	}
+	zr, err := gzip.NewReader(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unzipped, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(unzipped, []byte(plain)) {
+		t.Errorf("decompressed body differs from the uncompressed response:\n%s\n%s", unzipped, plain)
+	}
+	if len(body) >= len(plain) {
+		t.Errorf("compressed body is %d bytes, uncompressed %d", len(body), len(plain))
+	}
+
+	resp, body = send(t, app, "GET", "/users/1", "", "Accept-Encoding", "gzip")
+	if len(body) >= 200 {
+		t.Fatalf("small body is %d bytes; the test needs one under 200", len(body))
+	}
+	if got := resp.Header.Get("Content-Encoding"); got != "" {
+		t.Errorf("small body: Content-Encoding = %q, want none", got)
+	}
+	if decode[map[string]any](t, body)["id"] != float64(1) {
+		t.Errorf("small body: got %s", body)
+	}
+}
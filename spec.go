@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gofiber/fiber/v2"
+	"github.com/invopop/yaml"
+)
+
+// Paths the loaded spec is served on with --expose-spec.
+const (
+	specJSONPath = "/openapi.json"
+	specYAMLPath = "/openapi.yaml"
+)
+
+// registerSpecRoutes serves the loaded document. External $refs are pulled
+// into components first so the result stands alone. Both bodies are built
+// once up front; the routes are mounted before the spec's own paths so a
+// spec path of the same name can't shadow them.
+func registerSpecRoutes(app *fiber.App, doc *openapi3.T) {
+	doc.InternalizeRefs(context.Background(), nil)
+
+	jsonBody, err := doc.MarshalJSON()
+	if err != nil {
+		log.Fatalf("failed to marshal openapi: %v", err)
+	}
+	yamlBody, err := yaml.JSONToYAML(jsonBody)
+	if err != nil {
+		log.Fatalf("failed to marshal openapi: %v", err)
+	}
+
+	for _, p := range []string{specJSONPath, specYAMLPath} {
+		if doc.Paths.Find(p) != nil {
+			log.Printf("⚠️  The spec defines %s; it is shadowed by --expose-spec", p)
+		}
+	}
+
+	app.Get(specJSONPath, func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+		return c.Send(jsonBody)
+	})
+	app.Get(specYAMLPath, func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, "application/yaml; charset=utf-8")
+		return c.Send(yamlBody)
+	})
+}
@@ -2,26 +2,431 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+
+	"github.com/invopop/yaml"
+)
+
+// codec marshals the store's contents for one file format.
+type codec struct {
+	marshal   func(v any) ([]byte, error)
+	unmarshal func(b []byte, v any) error
+}
+
+var (
+	jsonCodec = codec{
+		marshal:   func(v any) ([]byte, error) { return json.MarshalIndent(v, "", "  ") },
+		unmarshal: json.Unmarshal,
+	}
+	// yaml goes through JSON under the hood, so numbers still decode as
+	// float64 exactly like they do for .json files.
+	yamlCodec = codec{
+		marshal:   yaml.Marshal,
+		unmarshal: func(b []byte, v any) error { return yaml.Unmarshal(b, v) },
+	}
 )
 
+// codecFor picks the codec from the data file's extension; anything other
+// than .yaml/.yml is treated as JSON.
+func codecFor(file string) codec {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return yamlCodec
+	}
+	return jsonCodec
+}
+
+// Store holds the mock data, one collection per resource. Each collection
+// has its own lock, so writes to /users don't block reads of /products.
 type Store struct {
-	mu   sync.Mutex
-	Data map[string][]map[string]any
+	// mu guards the collections map itself; records are guarded by their
+	// collection's lock.
+	mu          sync.RWMutex
+	collections map[string]*Collection
+
+	// calls counts hits per endpoint for x-mock-sequence. Not persisted.
+	callsMu sync.Mutex
+	calls   map[string]int
+
+	// dir is set when --data names a directory holding one file per
+	// resource; files remembers which file each loaded resource came from.
+	dir   string
+	files map[string]string
+
+	// snapMu serialises snapshots so they reach the writer in mutation
+	// order. It also guards files and every collection's encoded form.
+	snapMu sync.Mutex
+
+	// writer persists snapshots off the request path.
+	writer *fileWriter
+
+	// inMemory turns Save and SaveResource into no-ops (--no-persist).
+	inMemory bool
 }
 
-func NewStore(file string) *Store {
-	s := &Store{Data: map[string][]map[string]any{}}
+// Collection is one resource's records. Hold RLock to read Records and Lock
+// to change them; go through Append, Remove and Reindex so the id index
+// stays in step.
+type Collection struct {
+	sync.RWMutex
+	Records []map[string]any
 
-	if b, err := os.ReadFile(file); err == nil {
-		_ = json.Unmarshal(b, &s.Data)
+	// index maps a record's id to its position in Records. When ids
+	// repeat, the first record wins, as it would in a linear scan.
+	index map[int]int
+
+	// maxID is the highest id in Records, kept so NextID doesn't scan.
+	maxID int
+
+	// encoded is the last persisted form of Records, kept so a single-file
+	// save never has to lock other collections.
+	encoded json.RawMessage
+}
+
+// NewStore loads file, the one changes are written back to, then merges each
+// overlay over it in order. Overlay records replace the fields of the record
+// with the same id, or are appended when there is none.
+func NewStore(file string, overlays ...string) *Store {
+	s := &Store{
+		collections: map[string]*Collection{},
+		calls:       map[string]int{},
+		files:       map[string]string{},
+		writer:      newFileWriter(),
+	}
+
+	if isDataDir(file) {
+		s.dir = file
+		data, files := readDataDir(file)
+		for resource, records := range data {
+			s.add(resource, records)
+		}
+		s.files = files
+	} else {
+		for resource, records := range readDataFile(file) {
+			s.add(resource, records)
+		}
+	}
+
+	for _, overlay := range overlays {
+		var data map[string][]map[string]any
+		if isDataDir(overlay) {
+			data, _ = readDataDir(overlay)
+		} else {
+			data = readDataFile(overlay)
+		}
+		for resource, records := range data {
+			s.merge(resource, records)
+		}
 	}
 	return s
 }
 
-func (s *Store) Save(file string) {
-	// Note: caller should hold the lock
-	b, _ := json.MarshalIndent(s.Data, "", "  ")
-	_ = os.WriteFile(file, b, 0644)
+// Collection returns the named resource's collection, creating an empty one
+// on first use.
+func (s *Store) Collection(resource string) *Collection {
+	s.mu.RLock()
+	col := s.collections[resource]
+	s.mu.RUnlock()
+	if col != nil {
+		return col
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if col = s.collections[resource]; col == nil {
+		col = newCollection(nil)
+		s.collections[resource] = col
+	}
+	return col
+}
+
+// Lookup returns the named collection, or nil if there is none.
+func (s *Store) Lookup(resource string) *Collection {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.collections[resource]
+}
+
+// Names returns the store's resource names in order.
+func (s *Store) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.collections))
+	for name := range s.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// add installs a loaded collection. Only used while the store is built.
+func (s *Store) add(resource string, records []map[string]any) {
+	s.collections[resource] = newCollection(records)
+}
+
+// merge folds overlay records into a loaded collection by id. Only used
+// while the store is built.
+func (s *Store) merge(resource string, records []map[string]any) {
+	col := s.collections[resource]
+	if col == nil {
+		s.add(resource, records)
+		return
+	}
+	for _, record := range records {
+		if _, existing := col.Find(recordID(record)); existing != nil {
+			for k, v := range record {
+				existing[k] = v
+			}
+			continue
+		}
+		col.Append(record)
+	}
+	col.encoded, _ = json.Marshal(col.Records)
+}
+
+func newCollection(records []map[string]any) *Collection {
+	if records == nil {
+		records = []map[string]any{}
+	}
+	col := &Collection{Records: records}
+	col.Reindex()
+	col.encoded, _ = json.Marshal(records)
+	return col
+}
+
+// Find returns the position and record with the given id, or -1 and nil.
+func (c *Collection) Find(id int) (int, map[string]any) {
+	if i, ok := c.index[id]; ok {
+		return i, c.Records[i]
+	}
+	return -1, nil
+}
+
+// NextID returns the id for a new record: one past the highest id in the
+// collection, so it can't clash with a client-supplied one.
+func (c *Collection) NextID() int {
+	return c.maxID + 1
+}
+
+// Append adds a record at the end of the collection.
+func (c *Collection) Append(record map[string]any) {
+	c.Records = append(c.Records, record)
+	if id := recordID(record); id != 0 {
+		if _, dup := c.index[id]; !dup {
+			c.index[id] = len(c.Records) - 1
+		}
+		c.maxID = max(c.maxID, id)
+	}
+}
+
+// Remove deletes the record at position i. Later records shift down, so the
+// index is rebuilt.
+func (c *Collection) Remove(i int) {
+	c.Records = append(c.Records[:i], c.Records[i+1:]...)
+	c.Reindex()
+}
+
+// Reindex rebuilds the id index, e.g. after a record's id changed.
+func (c *Collection) Reindex() {
+	c.index = make(map[int]int, len(c.Records))
+	c.maxID = 0
+	for i, record := range c.Records {
+		id := recordID(record)
+		if _, dup := c.index[id]; id != 0 && !dup {
+			c.index[id] = i
+		}
+		c.maxID = max(c.maxID, id)
+	}
+}
+
+// isDataDir reports whether --data points at a directory, either an existing
+// one or a not-yet-created path written with a trailing slash.
+func isDataDir(file string) bool {
+	if fi, err := os.Stat(file); err == nil {
+		return fi.IsDir()
+	}
+	return strings.HasSuffix(file, "/") || strings.HasSuffix(file, string(os.PathSeparator))
+}
+
+// readDataFile reads a single data file holding every resource. A missing
+// or unreadable file yields no data.
+func readDataFile(file string) map[string][]map[string]any {
+	data := map[string][]map[string]any{}
+	if b, err := os.ReadFile(file); err == nil {
+		_ = codecFor(file).unmarshal(b, &data)
+	}
+	return data
+}
+
+// readDataDir reads every .json/.yaml/.yml file in dir as the resource named
+// after the file, and reports which file each resource came from.
+func readDataDir(dir string) (map[string][]map[string]any, map[string]string) {
+	data := map[string][]map[string]any{}
+	files := map[string]string{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return data, files
+	}
+	for _, e := range entries {
+		name := e.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		if e.IsDir() || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		b, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var records []map[string]any
+		if err := codecFor(path).unmarshal(b, &records); err != nil {
+			continue
+		}
+		resource := strings.TrimSuffix(name, filepath.Ext(name))
+		data[resource] = records
+		files[resource] = path
+	}
+	return data, files
+}
+
+// SaveResource writes one resource back to its own file in directory mode.
+// Resources that were not loaded from disk go to <resource>.json.
+func (s *Store) SaveResource(resource string) {
+	// Note: caller should hold the collection's lock
+	if s.inMemory {
+		return
+	}
+	records := s.Collection(resource).Records
+
+	s.snapMu.Lock()
+	defer s.snapMu.Unlock()
+	path, ok := s.files[resource]
+	if !ok {
+		path = filepath.Join(s.dir, resource+".json")
+		s.files[resource] = path
+	}
+	b, _ := codecFor(path).marshal(records)
+	s.writer.enqueue(path, b)
+}
+
+// Save writes every resource to file after re-encoding the one that changed.
+func (s *Store) Save(file, resource string) {
+	// Note: caller should hold the collection's lock
+	if s.inMemory {
+		return
+	}
+	col := s.Collection(resource)
+	encoded, _ := json.Marshal(col.Records)
+
+	s.snapMu.Lock()
+	defer s.snapMu.Unlock()
+	col.encoded = encoded
+
+	s.mu.RLock()
+	data := make(map[string]json.RawMessage, len(s.collections))
+	for name, c := range s.collections {
+		data[name] = c.encoded
+	}
+	s.mu.RUnlock()
+
+	b, _ := codecFor(file).marshal(data)
+	s.writer.enqueue(file, b)
+}
+
+// Flush blocks until every queued snapshot is on disk, and reports the
+// files whose last write failed.
+func (s *Store) Flush() error {
+	return s.writer.flush()
+}
+
+// NextCall returns how many times key has been called before, then counts
+// this call.
+func (s *Store) NextCall(key string) int {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	n := s.calls[key]
+	s.calls[key] = n + 1
+	return n
+}
+
+// fileWriter writes store snapshots in the background so responses don't
+// wait on the disk. Snapshots are marshalled under the store lock, so they
+// already reflect the order mutations happened in; the writer only keeps the
+// latest one per file and writes them one batch at a time.
+type fileWriter struct {
+	mu      sync.Mutex
+	pending map[string][]byte
+	wake    chan struct{}
+
+	// writing is held while a batch is on its way to disk, so flush can
+	// wait for it. It also guards failed.
+	writing sync.Mutex
+
+	// failed holds the error of each path whose last write failed.
+	failed map[string]error
+}
+
+func newFileWriter() *fileWriter {
+	w := &fileWriter{
+		pending: map[string][]byte{},
+		wake:    make(chan struct{}, 1),
+		failed:  map[string]error{},
+	}
+	go w.run()
+	return w
+}
+
+// enqueue replaces any snapshot still waiting for path and wakes the writer.
+func (w *fileWriter) enqueue(path string, b []byte) {
+	w.mu.Lock()
+	w.pending[path] = b
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *fileWriter) run() {
+	for range w.wake {
+		_ = w.flush()
+	}
+}
+
+// flush writes everything pending, after any batch already in progress,
+// and returns the failures still standing, background writes included.
+func (w *fileWriter) flush() error {
+	w.writing.Lock()
+	defer w.writing.Unlock()
+
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = map[string][]byte{}
+	w.mu.Unlock()
+
+	for path, b := range batch {
+		_ = os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, b, 0644); err != nil {
+			w.failed[path] = err
+		} else {
+			delete(w.failed, path)
+		}
+	}
+
+	paths := make([]string, 0, len(w.failed))
+	for path := range w.failed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	errs := make([]error, len(paths))
+	for i, path := range paths {
+		errs[i] = w.failed[path]
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/invopop/yaml"
+)
+
+// loadDocument loads an OpenAPI 3 file, or a Swagger 2.0 file converted to
+// OpenAPI 3, so everything past loading only deals with version 3.
+func loadDocument(loader *openapi3.Loader, path string) (*openapi3.T, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var probe struct {
+		Swagger string `json:"swagger"`
+	}
+	if err := yaml.Unmarshal(b, &probe); err != nil || probe.Swagger == "" {
+		return loader.LoadFromFile(path)
+	}
+	if !strings.HasPrefix(probe.Swagger, "2.") {
+		return nil, fmt.Errorf("unsupported swagger version %q (want 2.0 or an openapi 3 document)", probe.Swagger)
+	}
+
+	var doc2 openapi2.T
+	if err := yaml.Unmarshal(b, &doc2); err != nil {
+		return nil, fmt.Errorf("reading swagger %s: %w", probe.Swagger, err)
+	}
+	doc, err := openapi2conv.ToV3WithLoader(&doc2, loader, &url.URL{Path: filepath.ToSlash(path)})
+	if err != nil {
+		return nil, fmt.Errorf("converting swagger %s to openapi 3: %w", probe.Swagger, err)
+	}
+	log.Printf("🔄 Converted Swagger %s to OpenAPI %s", probe.Swagger, doc.OpenAPI)
+	return doc, nil
+}
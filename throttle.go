@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// throttleThreshold is the smallest body --throttle slows down; anything
+// shorter goes out at once.
+const throttleThreshold = 1 << 10
+
+// parseBandwidth turns a --throttle value such as "100kbps" or "2mbps" into
+// bytes per second. Units are bits per second with decimal prefixes; a bare
+// number is bps.
+func parseBandwidth(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	units := []struct {
+		suffix string
+		scale  float64
+	}{
+		{"gbps", 1e9}, {"mbps", 1e6}, {"kbps", 1e3}, {"bps", 1},
+	}
+	scale := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			scale = u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q (want e.g. 100kbps or 2mbps)", s)
+	}
+	return max(int(n*scale/8), 1), nil
+}
+
+// throttleBody replaces a response body longer than throttleThreshold with
+// a stream that trickles out at rate bytes per second. The stream is sent
+// chunked: fasthttp flushes every chunk, whereas with a Content-Length it
+// buffers bodies of a few KB and sends them whole at the end. HEAD responses
+// have no body to slow down and keep their Content-Length.
+func throttleBody(c *fiber.Ctx, rate int) {
+	body := c.Response().Body()
+	if len(body) <= throttleThreshold || c.Method() == fiber.MethodHead {
+		return
+	}
+	data := bytes.Clone(body)
+	c.Response().SetBodyStream(&throttledReader{r: bytes.NewReader(data), rate: rate}, -1)
+}
+
+// throttledReader hands out at most a tenth of a second's worth of bytes
+// per Read and sleeps until those bytes are due.
+type throttledReader struct {
+	r     io.Reader
+	rate  int // bytes per second
+	start time.Time
+	sent  int
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	if chunk := max(t.rate/10, 1); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.r.Read(p)
+	t.sent += n
+	due := t.start.Add(time.Duration(float64(t.sent) / float64(t.rate) * float64(time.Second)))
+	time.Sleep(time.Until(due))
+	return n, err
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrottleStreamsWithAccessLog(t *testing.T) {
+	users := make([]map[string]any, 20)
+	for i := range users {
+		users[i] = map[string]any{"id": i + 1, "name": strings.Repeat("x", 100)}
+	}
+	data, _ := json.Marshal(map[string]any{"users": users})
+
+	logFile := filepath.Join(t.TempDir(), "access.log")
+	app := newTestApp(t, testSpec, string(data), &Options{
+		Throttle:      4000, // about half a second for the ~2KB body
+		AccessLog:     "common",
+		AccessLogFile: logFile,
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = app.Listener(ln) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	start := time.Now()
+	resp, err := http.Get("http://" + ln.Addr().String() + "/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := resp.Body.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	firstByte := time.Since(start)
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	total := time.Since(start)
+
+	if total < 300*time.Millisecond {
+		t.Fatalf("body took %s; it wasn't throttled", total)
+	}
+	if firstByte > total/2 {
+		t.Errorf("first byte after %s of %s; the body was buffered before sending", firstByte, total)
+	}
+}
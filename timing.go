@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// loadTiming reads a --timing file mapping "METHOD /path" to a delay, e.g.
+// {"GET /users": "200ms", "POST /orders": "1s"}. Paths are spec paths, as
+// for --status. Delays are Go durations; bare numbers are milliseconds.
+func loadTiming(file string) (map[string]time.Duration, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]any
+	if err := codecFor(file).unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	timing := make(map[string]time.Duration, len(raw))
+	for route, v := range raw {
+		key, err := parseRouteKey(route)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+
+		var d time.Duration
+		switch v := v.(type) {
+		case float64:
+			d = time.Duration(v * float64(time.Millisecond))
+		case string:
+			if d, err = time.ParseDuration(v); err != nil {
+				return nil, fmt.Errorf("%s: delay for %s: %v", file, route, err)
+			}
+		default:
+			return nil, fmt.Errorf("%s: delay for %s must be a duration such as \"200ms\"", file, route)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("%s: delay for %s must not be negative", file, route)
+		}
+		timing[key] = d
+	}
+	return timing, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// mockStatusWeights holds the parsed x-mock-status-weights of every
+// operation, filled by compileExtensions.
+var mockStatusWeights = map[*openapi3.Operation][]statusWeight{}
+
+// statusWeight is one x-mock-status-weights entry.
+type statusWeight struct {
+	Status int
+	Weight float64
+}
+
+// compileStatusWeights parses an operation's x-mock-status-weights, e.g.
+//
+//	x-mock-status-weights: {200: 0.8, 500: 0.2}
+//
+// Weights are relative, so {200: 4, 500: 1} means the same. Every status
+// must be one the operation declares, so it has a response to send.
+func compileStatusWeights(where string, op *openapi3.Operation) error {
+	raw, ok := op.Extensions[extStatusWeights]
+	if !ok {
+		return nil
+	}
+	entries, ok := raw.(map[string]any)
+	if !ok || len(entries) == 0 {
+		return fmt.Errorf("%s: %s must map statuses to weights", where, extStatusWeights)
+	}
+
+	weights := make([]statusWeight, 0, len(entries))
+	total := 0.0
+	for code, v := range entries {
+		status, err := strconv.Atoi(code)
+		if err != nil || status < 100 || status > 599 {
+			return fmt.Errorf("%s: %s: invalid status %q", where, extStatusWeights, code)
+		}
+		if _, ok := declaredResponse(op, status); !ok {
+			return fmt.Errorf("%s: %s: status %d is not a declared response", where, extStatusWeights, status)
+		}
+		weight, ok := v.(float64)
+		if !ok || weight < 0 {
+			return fmt.Errorf("%s: %s.%s: weight must be a number of at least 0, got %v", where, extStatusWeights, code, v)
+		}
+		weights = append(weights, statusWeight{Status: status, Weight: weight})
+		total += weight
+	}
+	if total <= 0 {
+		return fmt.Errorf("%s: %s: weights add up to 0", where, extStatusWeights)
+	}
+	// Sorted so a roll picks the same status for the same number.
+	sort.Slice(weights, func(i, j int) bool { return weights[i].Status < weights[j].Status })
+	mockStatusWeights[op] = weights
+	return nil
+}
+
+// rollStatus picks one of op's x-mock-status-weights statuses at random,
+// in proportion to its weight, rolling rng when it is set.
+func rollStatus(op *openapi3.Operation, rng *rand.Rand) (int, bool) {
+	weights := mockStatusWeights[op]
+	if len(weights) == 0 {
+		return 0, false
+	}
+	total := 0.0
+	for _, w := range weights {
+		total += w.Weight
+	}
+	random := rand.Float64
+	if rng != nil {
+		random = rng.Float64
+	}
+	roll := random() * total
+	for _, w := range weights {
+		if roll < w.Weight {
+			return w.Status, true
+		}
+		roll -= w.Weight
+	}
+	return weights[len(weights)-1].Status, true
+}